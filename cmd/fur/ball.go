@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const ballUsage = `
+Work with furballs, the recordings of requests and responses made by 'fur -ball'.
+
+Furballs come in three formats. The original JSON format is a single object that
+has to be loaded and rewritten in its entirety every time something is added to
+it. The JSONL format has one entry per line, which is appended to as each
+response is recorded, so it stays fast no matter how big it gets. The directory
+format is like JSONL, but stores each distinct response once, gzipped, so
+recording the same large file many times doesn't use any more space.
+
+New furballs use the directory format if the name ends in '/', JSONL if the name
+ends in '.jsonl', otherwise JSON. Existing furballs are detected by their header
+(or by being a directory) regardless of name. Use 'fur ball convert' to switch
+between them.
+`
+
+// openBall sets up recording to the -ball file. Balls in the JSON format are recorded
+// in memory, then appended to the file by the returned function; JSONL and directory
+// balls are appended to as each response is recorded. Either way, the file is only
+// locked while it is written, so concurrent fetches to the same ball don't wait for
+// each other.
+func (cmd *command) openBall(ctx context.Context) (done func() error, err error) {
+	format, err := furball.DetectFormat(cmd.ballFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == furball.FormatJSONL || format == furball.FormatDir {
+		app, err := furball.OpenAppender(cmd.ballFile)
+		if err != nil {
+			return nil, err
+		}
+		cmd.recorder = app
+		return app.Close, nil
+	}
+
+	ball := &furball.Ball{}
+	cmd.recorder = ball
+	return func() error {
+		if len(ball.Entries) == 0 {
+			return nil
+		}
+		return furball.AppendBallFile(ctx, cmd.ballFile, ball.Entries)
+	}, nil
+}
+
+func newBallGroup() cmdy.Command {
+	return cmdy.NewGroup(
+		"Work with furballs",
+		cmdy.Builders{
+			"convert": func() cmdy.Command { return &ballConvertCommand{} },
+			"export":  func() cmdy.Command { return &ballExportCommand{} },
+			"grep":    func() cmdy.Command { return &ballGrepCommand{} },
+			"ls":      func() cmdy.Command { return &ballListCommand{} },
+			"prune":   func() cmdy.Command { return &ballPruneCommand{} },
+			"serve":   func() cmdy.Command { return &ballServeCommand{} },
+			"show":    func() cmdy.Command { return &ballShowCommand{} },
+		},
+		cmdy.GroupUsage(ballUsage),
+	)
+}
+
+const ballServeUsage = `
+Serve the responses recorded in a furball as a Gopher server, so tools (including
+fur itself) can be tested against a real gopherhole without touching the network.
+
+Each request is answered with the recorded response for the same selector and
+search, byte-for-byte, so recorded errors are served as they were received. If a
+selector was recorded more than once, the last recording wins. Selectors that were
+never recorded get a '3' error.
+
+Links in recorded menus still point at the original servers.
+
+The address that is actually listened on is printed to stderr, which is useful if
+the port in -listen is 0.
+`
+
+type ballServeCommand struct {
+	file   string
+	listen string
+}
+
+func (cmd *ballServeCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Serve a furball's responses as a Gopher server",
+		Usage:    ballServeUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Serve on port 7070", Command: "ball.json"},
+			cmdy.Example{Desc: "Serve on a random local port", Command: "-listen 127.0.0.1:0 ball.json"},
+		},
+	}
+}
+
+func (cmd *ballServeCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	flags.StringVar(&cmd.listen, "listen", ":7070", "Address to listen on")
+	args.String(&cmd.file, "ball", "Furball file")
+}
+
+func (cmd *ballServeCommand) Run(ctx cmdy.Context) error {
+	ball, err := furball.LoadBallFile(cmd.file)
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", cmd.listen)
+	if err != nil {
+		return err
+	}
+
+	srv := &gopher.Server{
+		Handler: furball.NewHandler(ball),
+
+		// caps.txt is served from the furball if it was recorded:
+		DisableCaps: true,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	fmt.Fprintf(ctx.Stderr(), "serving %d entries from %q on %s\n", len(ball.Entries), cmd.file, ln.Addr())
+
+	if err := srv.Serve(ln, ""); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+const ballExportUsage = `
+Convert a furball to a standard archive format, so recordings can be used with
+other tools:
+
+    har        HAR 1.2 JSON, for HTTP analysis tools
+    warc       WARC 1.1 (ISO 28500), for web archiving tools
+
+HAR is built for HTTP, so Gopher requests are presented as GET requests without
+headers, with a status of 200 for success.
+
+If the output file ends in '.gz', WARC files are compressed one record at a time,
+as expected of a '.warc.gz' file.
+`
+
+type ballExportCommand struct {
+	file   string
+	format string
+	out    string
+}
+
+func (cmd *ballExportCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Export a furball as HAR or WARC",
+		Usage:    ballExportUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Export as HAR to stdout", Command: "ball.json"},
+			cmdy.Example{Desc: "Export as compressed WARC", Command: "-format=warc -o ball.warc.gz ball.json"},
+		},
+	}
+}
+
+func (cmd *ballExportCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	flags.StringVar(&cmd.format, "format", "har", "Output format (har, warc)")
+	flags.StringVar(&cmd.out, "o", "", "Output file (default stdout)")
+	args.String(&cmd.file, "ball", "Furball file")
+}
+
+func (cmd *ballExportCommand) Run(ctx cmdy.Context) (rerr error) {
+	var export func(w io.Writer, ball *furball.Ball) error
+	switch cmd.format {
+	case "har":
+		export = furball.WriteHAR
+	case "warc":
+		compress := strings.HasSuffix(cmd.out, ".gz")
+		export = func(w io.Writer, ball *furball.Ball) error {
+			return furball.WriteWARC(w, ball, compress)
+		}
+	default:
+		return cmdy.ErrWithCode(cmdy.ExitUsage, fmt.Errorf("unknown -format %q", cmd.format))
+	}
+
+	ball, err := furball.LoadBallFile(cmd.file)
+	if err != nil {
+		return err
+	}
+
+	out, _, err := stdoutOrFileWriter(ctx.Stdout(), cmd.out, true)
+	if err != nil {
+		return err
+	}
+	defer DeferClose(&rerr, out)
+
+	return export(out, ball)
+}
+
+type ballConvertCommand struct {
+	in     string
+	out    string
+	format string
+}
+
+func (cmd *ballConvertCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Convert a furball between the JSON, JSONL and directory formats",
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Convert to JSONL", Command: "ball.json ball.jsonl"},
+			cmdy.Example{Desc: "Convert to JSON", Command: "-format=json ball.jsonl ball.json"},
+			cmdy.Example{Desc: "Convert to a directory", Command: "ball.json ball/"},
+		},
+	}
+}
+
+func (cmd *ballConvertCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	flags.StringVar(&cmd.format, "format", "", "Output format (json, jsonl, dir); defaults to dir if <out> ends in '/', jsonl if it ends in '.jsonl', otherwise json")
+	args.String(&cmd.in, "in", "Furball file to convert")
+	args.String(&cmd.out, "out", "Output file, which is replaced if it exists, or directory, which must not exist yet")
+}
+
+func (cmd *ballConvertCommand) Run(ctx cmdy.Context) error {
+	format := furball.FormatForExt(cmd.out)
+	if cmd.format != "" {
+		var err error
+		if format, err = furball.ParseFormat(cmd.format); err != nil {
+			return cmdy.ErrWithCode(cmdy.ExitUsage, err)
+		}
+	}
+	return furball.ConvertBallFile(cmd.in, cmd.out, format)
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+	"github.com/shabbyrobe/cmdy/flags"
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// eachEntry calls fn with each entry in the furball at path, numbered from 1 like
+// 'fur replay' does, without loading the whole ball. If fn returns false, iteration
+// stops.
+func eachEntry(path string, fn func(n int, e *furball.Entry) bool) error {
+	rdr, closer, err := furball.OpenBallFile(path)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	for n := 1; ; n++ {
+		e, err := rdr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !fn(n, e) {
+			return nil
+		}
+	}
+}
+
+type entryTable struct {
+	tw *tabwriter.Writer
+}
+
+func newEntryTable(w io.Writer) *entryTable {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "#\tTIME\tSTATUS\tTAKEN\tSIZE\tURL\n")
+	return &entryTable{tw: tw}
+}
+
+func (et *entryTable) add(n int, e *furball.Entry) {
+	status := "ok"
+	if e.Status != gopher.OK {
+		status = strconv.Itoa(int(e.Status))
+	}
+	taken := time.Duration(e.Taken).Round(time.Microsecond)
+	fmt.Fprintf(et.tw, "%d\t%s\t%s\t%s\t%d\t%s\n", n, e.At.Local().Format("2006-01-02 15:04:05"), status, taken, len(e.Out), e.URL)
+}
+
+func (et *entryTable) flush() error { return et.tw.Flush() }
+
+type ballListCommand struct {
+	file string
+}
+
+func (cmd *ballListCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "List the entries in a furball",
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "List entries", Command: "ball.json"},
+		},
+	}
+}
+
+func (cmd *ballListCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	args.String(&cmd.file, "ball", "Furball file")
+}
+
+func (cmd *ballListCommand) Run(ctx cmdy.Context) error {
+	tbl := newEntryTable(ctx.Stdout())
+	if err := eachEntry(cmd.file, func(n int, e *furball.Entry) bool {
+		tbl.add(n, e)
+		return true
+	}); err != nil {
+		return err
+	}
+	return tbl.flush()
+}
+
+const ballShowUsage = `
+Render a single entry from a furball, as 'fur replay' would, after printing what
+was recorded about it to stderr. Use -raw to dump the response exactly as it was
+received instead.
+
+Entries are numbered from 1, as shown by 'fur ball ls'.
+`
+
+type ballShowCommand struct {
+	replayCommand
+	num int
+}
+
+func (cmd *ballShowCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Show an entry in a furball",
+		Usage:    ballShowUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Render the third entry", Command: "ball.json 3"},
+			cmdy.Example{Desc: "Dump the third entry raw", Command: "-raw ball.json 3"},
+		},
+	}
+}
+
+func (cmd *ballShowCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	cmd.command.configureRenderFlags(flags)
+	args.String(&cmd.file, "ball", "Furball file")
+	args.Int(&cmd.num, "n", "Entry number, starting at 1")
+}
+
+func (cmd *ballShowCommand) Run(ctx cmdy.Context) error {
+	if cmd.raw && cmd.txt {
+		return fmt.Errorf("-raw and -txt are mutually exclusive")
+	}
+
+	var found *furball.Entry
+	if err := eachEntry(cmd.file, func(n int, e *furball.Entry) bool {
+		if n == cmd.num {
+			found = e
+		}
+		return found == nil
+	}); err != nil {
+		return err
+	}
+	if found == nil {
+		return fmt.Errorf("no entry numbered %d in %q", cmd.num, cmd.file)
+	}
+
+	tw := tabwriter.NewWriter(ctx.Stderr(), 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "URL:\t%s\n", found.URL)
+	fmt.Fprintf(tw, "Time:\t%s\n", found.At.Local().Format("2006-01-02 15:04:05.000"))
+	fmt.Fprintf(tw, "Taken:\t%s\n", found.Taken)
+	if t := found.Timing; t != nil {
+		fmt.Fprintf(tw, "Phases:\tdns %s, connect %s, tls %s, ttfb %s, transfer %s\n", t.DNS, t.Connect, t.TLS, t.TTFB, t.Transfer)
+	}
+	if found.Status != gopher.OK {
+		fmt.Fprintf(tw, "Status:\t%d %s\n", found.Status, found.Msg)
+	}
+	fmt.Fprintf(tw, "Request:\t%q\n", found.In)
+	fmt.Fprintf(tw, "Size:\t%d\n", len(found.Out))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(ctx.Stderr())
+
+	return cmd.replay(ctx, found)
+}
+
+const ballGrepUsage = `
+Search the responses in a furball for lines matching a regular expression (Go
+syntax), printing each match as '<entry>:<url>:<line>'. Binary responses that
+match are reported without printing the line.
+
+Exits with status 1 if nothing matches.
+`
+
+type ballGrepCommand struct {
+	file       string
+	pattern    string
+	ignoreCase bool
+	list       bool
+}
+
+func (cmd *ballGrepCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Search the responses in a furball",
+		Usage:    ballGrepUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Find responses mentioning floodgap", Command: "-i ball.json floodgap"},
+			cmdy.Example{Desc: "List entries containing links to port 7070", Command: "-l ball.json '\t7070\r?$'"},
+		},
+	}
+}
+
+func (cmd *ballGrepCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	flags.BoolVar(&cmd.ignoreCase, "i", false, "Ignore case")
+	flags.BoolVar(&cmd.list, "l", false, "Only list matching entries")
+	args.String(&cmd.file, "ball", "Furball file")
+	args.String(&cmd.pattern, "pattern", "Regular expression")
+}
+
+func (cmd *ballGrepCommand) Run(ctx cmdy.Context) error {
+	pattern := cmd.pattern
+	if cmd.ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	ptn, err := regexp.Compile(pattern)
+	if err != nil {
+		return cmdy.ErrWithCode(cmdy.ExitUsage, err)
+	}
+
+	out := ctx.Stdout()
+	var matches int
+	if err := eachEntry(cmd.file, func(n int, e *furball.Entry) bool {
+		if !ptn.Match(e.Out) {
+			return true
+		}
+		matches++
+
+		if cmd.list {
+			fmt.Fprintf(out, "%d:%s\n", n, e.URL)
+			return true
+		}
+		if !utf8.Valid(e.Out) || bytes.IndexByte(e.Out, 0) >= 0 {
+			fmt.Fprintf(out, "%d:%s: binary response matches\n", n, e.URL)
+			return true
+		}
+		for _, line := range strings.Split(string(e.Out), "\n") {
+			if ptn.MatchString(line) {
+				fmt.Fprintf(out, "%d:%s:%s\n", n, e.URL, strings.TrimSuffix(line, "\r"))
+			}
+		}
+		return true
+	}); err != nil {
+		return err
+	}
+
+	if matches == 0 {
+		return cmdy.QuietExit(1)
+	}
+	return nil
+}
+
+const ballPruneUsage = `
+Remove entries from a furball, rewriting it in place. Entries are removed if they
+match every filter that is passed; at least one is required.
+
+-before takes either a date (2006-01-02), a time (RFC 3339), or a duration, which
+selects entries older than that, e.g. -before=720h removes entries older than 30
+days.
+
+-status takes a status code (see 'fur -h'), or 'error' for any failure.
+
+Furballs that store their responses in a directory have any responses that are no
+longer needed removed too.
+`
+
+type ballPruneCommand struct {
+	file   string
+	before string
+	hosts  flags.StringList
+	status string
+	dryRun bool
+}
+
+func (cmd *ballPruneCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Remove entries from a furball",
+		Usage:    ballPruneUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Remove entries older than a week", Command: "-before=168h ball.json"},
+			cmdy.Example{Desc: "Remove failures from floodgap", Command: "-host=gopher.floodgap.com -status=error ball.json"},
+			cmdy.Example{Desc: "Show what would be removed from before 2020", Command: "-n -before=2020-01-01 ball.json"},
+		},
+	}
+}
+
+func (cmd *ballPruneCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	flags.StringVar(&cmd.before, "before", "", "Remove entries recorded before this date, time or duration ago")
+	flags.Var(&cmd.hosts, "host", "Remove entries for this host, or host:port. Can pass multiple times.")
+	flags.StringVar(&cmd.status, "status", "", "Remove entries with this status, or 'error' for any failure")
+	flags.BoolVar(&cmd.dryRun, "n", false, "Dry run; list the entries that would be removed")
+	args.String(&cmd.file, "ball", "Furball file")
+}
+
+// parseBefore parses the -before flag.
+func parseBefore(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("-before %q is not a date, time or duration", s)
+}
+
+// matcher builds a function that returns true for entries that should be removed.
+func (cmd *ballPruneCommand) matcher() (func(e *furball.Entry) bool, error) {
+	var filters []func(e *furball.Entry) bool
+
+	if cmd.before != "" {
+		before, err := parseBefore(cmd.before, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, func(e *furball.Entry) bool {
+			return e.At.Before(before)
+		})
+	}
+
+	if len(cmd.hosts) > 0 {
+		filters = append(filters, func(e *furball.Entry) bool {
+			for _, host := range cmd.hosts {
+				if strings.EqualFold(host, e.URL.Hostname) || strings.EqualFold(host, e.URL.Host()) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+
+	if cmd.status == "error" {
+		filters = append(filters, func(e *furball.Entry) bool {
+			return e.Status != gopher.OK
+		})
+	} else if cmd.status != "" {
+		status, err := strconv.Atoi(cmd.status)
+		if err != nil {
+			return nil, fmt.Errorf("-status %q is not a status code or 'error'", cmd.status)
+		}
+		filters = append(filters, func(e *furball.Entry) bool {
+			return e.Status == gopher.Status(status)
+		})
+	}
+
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("at least one of -before, -host or -status is required")
+	}
+
+	return func(e *furball.Entry) bool {
+		for _, f := range filters {
+			if !f(e) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func (cmd *ballPruneCommand) Run(ctx cmdy.Context) error {
+	match, err := cmd.matcher()
+	if err != nil {
+		return cmdy.ErrWithCode(cmdy.ExitUsage, err)
+	}
+
+	if cmd.dryRun {
+		tbl := newEntryTable(ctx.Stdout())
+		if err := eachEntry(cmd.file, func(n int, e *furball.Entry) bool {
+			if match(e) {
+				tbl.add(n, e)
+			}
+			return true
+		}); err != nil {
+			return err
+		}
+		return tbl.flush()
+	}
+
+	removed, err := furball.RewriteBallFile(ctx, cmd.file, func(e *furball.Entry) bool {
+		return !match(e)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stderr(), "removed %d entries\n", removed)
+	return nil
+}
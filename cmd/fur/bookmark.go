@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+	"github.com/shabbyrobe/fur/internal/bookmark"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const bookmarkUsage = `
+Bookmarks are stored as a gophermap in $XDG_DATA_HOME/fur/bookmarks.gophermap, or
+the file in $FUR_BOOKMARKS if set. Bookmarks can be referred to by name, or by the
+number shown next to them by 'fur bm ls'.
+`
+
+func newBookmarkGroup() cmdy.Command {
+	return cmdy.NewGroup(
+		"Manage bookmarks",
+		cmdy.Builders{
+			"add":  func() cmdy.Command { return &bookmarkAddCommand{} },
+			"ls":   func() cmdy.Command { return &bookmarkListCommand{} },
+			"rm":   func() cmdy.Command { return &bookmarkRemoveCommand{} },
+			"open": func() cmdy.Command { return &bookmarkOpenCommand{} },
+		},
+		cmdy.GroupUsage(bookmarkUsage),
+	)
+}
+
+func bookmarkPath() (string, error) {
+	if file := os.Getenv("FUR_BOOKMARKS"); file != "" {
+		return file, nil
+	}
+	dir, err := userDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "fur", "bookmarks.gophermap"), nil
+}
+
+func loadBookmarks() (bookmark.Bookmarks, string, error) {
+	file, err := bookmarkPath()
+	if err != nil {
+		return nil, "", err
+	}
+	bms, err := bookmark.LoadFile(file)
+	return bms, file, err
+}
+
+func saveBookmarks(bms bookmark.Bookmarks, file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return bookmark.SaveFile(bms, file)
+}
+
+type bookmarkAddCommand struct {
+	url  urlVar
+	name string
+	tags string
+}
+
+func (cmd *bookmarkAddCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Add a bookmark, replacing any existing bookmark with the same name",
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Bookmark Floodgap", Command: "gopher://gopher.floodgap.com floodgap"},
+			cmdy.Example{Desc: "Bookmark with tags", Command: "gopher://gopherpedia.com pedia ref,wiki"},
+		},
+	}
+}
+
+func (cmd *bookmarkAddCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	args.Var(&cmd.url, "url", "Gopher url")
+	args.StringOptional(&cmd.name, "name", "", "Bookmark name. Defaults to the URL.")
+	args.StringOptional(&cmd.tags, "tags", "", "Comma separated list of tags")
+}
+
+func (cmd *bookmarkAddCommand) Run(ctx cmdy.Context) error {
+	var tags []string
+	for _, tag := range strings.Split(cmd.tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	bm, err := bookmark.New(cmd.url.URL(), cmd.name, tags)
+	if err != nil {
+		return err
+	}
+
+	bms, file, err := loadBookmarks()
+	if err != nil {
+		return err
+	}
+	return saveBookmarks(bms.Put(bm), file)
+}
+
+type bookmarkListCommand struct {
+	tag  string
+	cols int
+}
+
+func (cmd *bookmarkListCommand) Help() cmdy.Help {
+	return cmdy.Synopsis("List bookmarks")
+}
+
+func (cmd *bookmarkListCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	flags.IntVar(&cmd.cols, "cols", 0, "Wrap columns, 0 to detect")
+	args.StringOptional(&cmd.tag, "tag", "", "Only list bookmarks with this tag")
+}
+
+func (cmd *bookmarkListCommand) Run(ctx cmdy.Context) error {
+	bms, file, err := loadBookmarks()
+	if err != nil {
+		return err
+	}
+
+	var items [256]bool
+	for i := range items {
+		items[i] = true
+	}
+
+	var buf bytes.Buffer
+	if err := bookmark.Write(&buf, bms); err != nil {
+		return err
+	}
+
+	cols := cmd.cols
+	if cols == 0 {
+		cols, _ = termSize()
+	}
+
+	info := &gopher.ResponseInfo{Request: gopher.NewRequest(gopher.URL{Selector: file}, nil)}
+	rs := gopher.NewDirResponse(info, ioutil.NopCloser(&buf))
+	rnd := &dirRenderer{items: items, cols: cols, numbered: true}
+
+	// Bookmarks that don't match the tag are excluded from the menu, but not from the
+	// numbering, so the numbers can still be passed to 'fur bm open':
+	if cmd.tag != "" {
+		rnd.showLink = func(idx int) bool { return bms[idx].HasTag(cmd.tag) }
+	}
+	return rnd.Render(ctx.Stdout(), rs)
+}
+
+type bookmarkRemoveCommand struct {
+	ref string
+}
+
+func (cmd *bookmarkRemoveCommand) Help() cmdy.Help {
+	return cmdy.Synopsis("Remove a bookmark")
+}
+
+func (cmd *bookmarkRemoveCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	args.String(&cmd.ref, "ref", "Bookmark name or number")
+}
+
+func (cmd *bookmarkRemoveCommand) Run(ctx cmdy.Context) error {
+	bms, file, err := loadBookmarks()
+	if err != nil {
+		return err
+	}
+	idx := bms.Find(cmd.ref)
+	if idx < 0 {
+		return fmt.Errorf("bookmark %q not found", cmd.ref)
+	}
+	return saveBookmarks(bms.Remove(idx), file)
+}
+
+// bookmarkOpenCommand fetches a bookmark exactly as if its URL was passed to fur, and
+// so accepts all of the same flags.
+type bookmarkOpenCommand struct {
+	command
+	ref string
+}
+
+func (cmd *bookmarkOpenCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Open a bookmark",
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Open bookmark by name", Command: "floodgap"},
+			cmdy.Example{Desc: "Open bookmark by number, excluding 'i' types", Command: "-tx=i 2"},
+		},
+	}
+}
+
+func (cmd *bookmarkOpenCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	cmd.command.configureFlags(flags)
+
+	args.String(&cmd.ref, "ref", "Bookmark name or number")
+	args.StringOptional(&cmd.search, "search", "", "Search")
+}
+
+func (cmd *bookmarkOpenCommand) Run(ctx cmdy.Context) error {
+	bms, _, err := loadBookmarks()
+	if err != nil {
+		return err
+	}
+	idx := bms.Find(cmd.ref)
+	if idx < 0 {
+		return fmt.Errorf("bookmark %q not found", cmd.ref)
+	}
+
+	cmd.url = urlVar(bms[idx].URL)
+	return cmd.command.Run(ctx)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+	"github.com/shabbyrobe/fur/internal/cache"
+	"github.com/shabbyrobe/fur/internal/timing"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// The client only reads this much of the response looking for an error, so we do the
+// same for cached responses:
+const maxErrorDetect = 1024
+
+func responseCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "fur", "responses"), nil
+}
+
+func openResponseCache(ttl time.Duration) (*cache.Cache, error) {
+	dir, err := responseCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return cache.New(dir, ttl), nil
+}
+
+// fetchCached returns the cached response for rq if there is one, otherwise it fetches
+// the entire response and caches it before returning it.
+//
+// The response is fetched raw so that it can be stored exactly as it came off the wire,
+// then the client's error detection is replicated on the stored bytes. Only responses
+// that were read to completion without error are cached. The cache is only a
+// shortcut, so an entry that can't be read is fetched again, and a response that can't
+// be cached is still returned.
+func (cmd *command) fetchCached(ctx context.Context, client *gopher.Client, rq *gopher.Request) (gopher.Response, error) {
+	u := rq.URL()
+	now := time.Now()
+
+	if !cmd.cacheRefresh {
+		data, _, ok, err := cmd.cache.Get(u, now)
+		if err != nil {
+			fmt.Fprintf(cmd.cacheLog, "fur: ignoring cached response: %v\n", err)
+		} else if ok {
+			return newResponse(rq, data), nil
+		}
+	}
+
+	raw, err := client.Raw(ctx, rq)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(timing.FromContext(ctx).Reader(raw.Reader()))
+	raw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.DisableErrorIntercept {
+		head := data
+		if len(head) > maxErrorDetect {
+			head = head[:maxErrorDetect]
+		}
+		gerr := gopher.DetectError(head, func(status gopher.Status, msg string, confidence float64) *gopher.Error {
+			return gopher.NewError(u, status, msg, confidence)
+		})
+		if gerr != nil {
+			gerr.Raw = head
+			return nil, gerr
+		}
+	}
+
+	if err := cmd.cache.Put(u, now, data); err != nil {
+		fmt.Fprintf(cmd.cacheLog, "fur: could not cache response: %v\n", err)
+	}
+
+	rs := newResponse(rq, data)
+	rs.Info().TLS = raw.Info().TLS
+	return rs, nil
+}
+
+func newCacheGroup() cmdy.Command {
+	return cmdy.NewGroup(
+		"Manage the response cache",
+		cmdy.Builders{
+			"ls":    func() cmdy.Command { return &cacheListCommand{} },
+			"purge": func() cmdy.Command { return &cachePurgeCommand{} },
+		},
+	)
+}
+
+type cacheListCommand struct{}
+
+func (cmd *cacheListCommand) Help() cmdy.Help {
+	return cmdy.Synopsis("List cached responses, most recent first")
+}
+
+func (cmd *cacheListCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {}
+
+func (cmd *cacheListCommand) Run(ctx cmdy.Context) error {
+	c, err := openResponseCache(0)
+	if err != nil {
+		return err
+	}
+	entries, err := c.List()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tw := tabwriter.NewWriter(ctx.Stdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "AGE\tSIZE\tURL\n")
+	for _, e := range entries {
+		age := now.Sub(e.At).Truncate(time.Second)
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", age, e.Size, e.URL)
+	}
+	return tw.Flush()
+}
+
+type cachePurgeCommand struct {
+	older time.Duration
+}
+
+func (cmd *cachePurgeCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Remove cached responses",
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Remove everything", Command: ""},
+			cmdy.Example{Desc: "Remove responses older than a day", Command: "-older=24h"},
+		},
+	}
+}
+
+func (cmd *cachePurgeCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	flags.DurationVar(&cmd.older, "older", 0, "Only remove responses older than this")
+}
+
+func (cmd *cachePurgeCommand) Run(ctx cmdy.Context) error {
+	c, err := openResponseCache(0)
+	if err != nil {
+		return err
+	}
+
+	var before time.Time
+	if cmd.older > 0 {
+		before = time.Now().Add(-cmd.older)
+	}
+	n, err := c.Purge(before)
+	fmt.Fprintf(ctx.Stderr(), "purged %d responses\n", n)
+	return err
+}
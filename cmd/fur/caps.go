@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+	"github.com/shabbyrobe/fur/internal/cache"
+	"github.com/shabbyrobe/fur/internal/caps"
+	"github.com/shabbyrobe/fur/internal/tofu"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// newCapsSource creates a caps.Source that fetches caps.txt files using a copy of
+// client, storing them in the user's cache dir. Certificates are checked against pins,
+// which may be nil.
+//
+// The copy doesn't record to the furball, and falls back to plaintext if -tls is
+// passed, as caps are usually only served from the plaintext port, which is where we
+// find out what the TLS port is.
+func newCapsSource(client *gopher.Client, pins *tofu.Store) (*caps.Source, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	capsClient := *client
+	capsClient.CapsSource = nil
+	capsClient.Recorder = nil
+	if capsClient.TLSMode == gopher.TLSInsist {
+		capsClient.TLSMode = gopher.TLSWithInsecure
+	}
+
+	src := caps.NewSource(&capsClient, cache.New(filepath.Join(dir, "fur", "caps"), 0))
+	src.ClientFor = pins.Client
+	return src, nil
+}
+
+// capsTLSPort replaces the port in u with the ServerTLSPort from the server's caps, if
+// the URL is to be fetched using TLS and doesn't specify a port of its own.
+func (cmd *command) capsTLSPort(ctx context.Context, client *gopher.Client, u gopher.URL) (gopher.URL, error) {
+	if client.CapsSource == nil || !(u.IsSecure() || cmd.tlsInsist) {
+		return u, nil
+	}
+	if u.Port != "" && u.Port != "70" {
+		return u, nil
+	}
+
+	sc, err := client.CapsSource.LoadCaps(ctx, u.Hostname, u.Port)
+	if err != nil {
+		return u, err
+	}
+	if sc != nil {
+		if port := sc.TLSPort(); port > 0 {
+			u.Port = strconv.Itoa(port)
+		}
+	}
+	return u, nil
+}
+
+type capsCommand struct {
+	host    string
+	json    bool
+	refresh bool
+	timeout time.Duration
+}
+
+func newCapsCommand() cmdy.Command { return &capsCommand{} }
+
+func (cmd *capsCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Show a server's caps.txt",
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Show caps for floodgap", Command: "gopher.floodgap.com"},
+			cmdy.Example{Desc: "Show caps as JSON", Command: "-j gopher.floodgap.com:70"},
+			cmdy.Example{Desc: "Show caps from a URL", Command: "gopher://gopher.floodgap.com/1/world"},
+		},
+	}
+}
+
+func (cmd *capsCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	flags.BoolVar(&cmd.json, "j", false, "Render as JSON")
+	flags.BoolVar(&cmd.refresh, "refresh", false, "Ignore cached caps, fetch them again")
+	flags.DurationVar(&cmd.timeout, "t", 20*time.Second, "Timeout")
+	args.String(&cmd.host, "host", "Host name, host:port, or any gopher URL on the server")
+}
+
+func (cmd *capsCommand) hostPort() (host, port string, err error) {
+	if strings.Contains(cmd.host, "://") {
+		var uv urlVar
+		if err := uv.Set(cmd.host); err != nil {
+			return "", "", err
+		}
+		u := uv.URL()
+		return u.Hostname, u.Port, nil
+	}
+
+	host, port, err = net.SplitHostPort(cmd.host)
+	if err != nil {
+		// SplitHostPort fails if there is no port:
+		return cmd.host, "70", nil
+	}
+	return host, port, nil
+}
+
+func (cmd *capsCommand) Run(ctx cmdy.Context) error {
+	host, port, err := cmd.hostPort()
+	if err != nil {
+		return cmdy.ErrWithCode(cmdy.ExitUsage, err)
+	}
+
+	pins, err := loadPins(tofu.Strict)
+	if err != nil {
+		return err
+	}
+	pins.Log = ctx.Stderr()
+
+	src, err := newCapsSource(&gopher.Client{
+		Timeout: cmd.timeout,
+		TLSMode: gopher.TLSWithInsecure,
+	}, pins)
+	if err != nil {
+		return err
+	}
+
+	sc, err := src.Load(ctx, host, port, cmd.refresh)
+	if err != nil {
+		return err
+	} else if sc == nil {
+		return fmt.Errorf("%s has no caps.txt", net.JoinHostPort(host, port))
+	}
+
+	if cmd.json {
+		return json.NewEncoder(ctx.Stdout()).Encode(struct {
+			Host     string      `json:"host"`
+			Port     string      `json:"port"`
+			Pairs    []caps.Pair `json:"pairs"`
+			Comments []string    `json:"comments,omitempty"`
+		}{host, port, sc.Pairs, sc.Comments})
+	}
+
+	tw := tabwriter.NewWriter(ctx.Stdout(), 0, 4, 2, ' ', 0)
+	for _, pair := range sc.Pairs {
+		fmt.Fprintf(tw, "%s\t%s\n", pair.Key, pair.Value)
+	}
+	return tw.Flush()
+}
+
+// pathConfig returns the path rules for the server u is on. They come from the server's
+// caps if -caps was passed and the server has a caps file, otherwise POSIX rules are
+// presumed. client may be nil if there is no network access.
+func (cmd *command) pathConfig(ctx context.Context, client *gopher.Client, u gopher.URL) *gopher.PathConfig {
+	if client != nil && client.CapsSource != nil {
+		sc, err := client.CapsSource.LoadCaps(ctx, u.Hostname, u.Port)
+		if err == nil && sc != nil {
+			// Invalid keys are left at their defaults, which is good enough for
+			// navigating:
+			if pc, _ := sc.PathConfig(); pc != nil {
+				return pc
+			}
+		}
+	}
+	// Without caps nothing is known about the selectors, so nothing before the first
+	// delimiter is discarded; 'foo/bar' is below 'foo', not the root:
+	pc := gopher.UnixPathConfig
+	pc.KeepPreDelimiter = true
+	return &pc
+}
+
+// parentURL returns the URL of the menu above u.
+func (cmd *command) parentURL(ctx context.Context, client *gopher.Client, u gopher.URL) (gopher.URL, error) {
+	sel, ok := caps.Parent(cmd.pathConfig(ctx, client, u), u.Selector)
+	if u.Root || !ok {
+		return gopher.URL{}, fmt.Errorf("%s has no parent", u)
+	}
+
+	u.Root = false
+	u.ItemType = gopher.Dir
+	u.Selector = sel
+	u.Search = ""
+	return u, nil
+}
+
+// addCrumbs gives rnd a breadcrumb header for u, if rnd renders directories.
+func (cmd *command) addCrumbs(ctx context.Context, client *gopher.Client, rnd renderer, u gopher.URL) {
+	drnd, ok := rnd.(*dirRenderer)
+	if !ok || !cmd.crumbs {
+		return
+	}
+	crumbs := caps.Crumbs(cmd.pathConfig(ctx, client, u), u.Selector)
+	crumbs[0].Name = u.Host()
+	drnd.crumbs = crumbs
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+	"github.com/shabbyrobe/fur/internal/crawl"
+	"github.com/shabbyrobe/fur/internal/linkcheck"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const checkUsage = `
+Fetch a menu and probe every link in it, reporting the ones that are broken, one line
+at a time. With -r, menus on the same server are checked too, all the way down.
+
+Only the start of each document is read, which is enough to tell if it's there.
+Searches, telnet links and 'URL:' links aren't checked.
+
+If anything is broken, exits with the highest of the statuses 'fur' would exit with
+if it had fetched each broken link itself, so it can be used to check a gopherhole in
+CI. Dead hosts exit like a 503, and timeouts like a 408.
+
+Problems:
+    dead         Couldn't connect to the host
+    timeout      The host took longer than -t to respond
+    status       The server responded with an error
+    empty        The server responded with nothing
+    erroritem    A menu contains a '3' error item
+    error        Anything else that went wrong fetching the link
+
+Like 'fur crawl', robots.txt is honoured unless -norobots is passed.
+`
+
+// checkMaxRead is enough of a document to see whether it's an error.
+const checkMaxRead = 4096
+
+type checkCommand struct {
+	command
+	robotsFlags
+	recursive bool
+	depth     int
+	workers   int
+	delay     time.Duration
+}
+
+func newCheckCommand() cmdy.Command { return &checkCommand{} }
+
+func (cmd *checkCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Check a gopherhole for broken links",
+		Usage:    checkUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Check the links in a menu", Command: "gopher://localhost/"},
+			cmdy.Example{Desc: "Check a whole gopherhole as JSON lines", Command: "-r -j gopher://localhost/"},
+		},
+	}
+}
+
+func (cmd *checkCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	cmd.command.configureClientFlags(flags)
+	cmd.configureRobotsFlags(flags)
+
+	flags.BoolVar(&cmd.recursive, "r", false, "Check menus on the same server as the URL, recursively")
+	flags.IntVar(&cmd.depth, "depth", 20, "With -r, follow links this many menus deep")
+	flags.IntVar(&cmd.workers, "workers", 4, "Number of links to check at once")
+	flags.DurationVar(&cmd.delay, "delay", 1*time.Second, "Minimum time between requests to the same host")
+	flags.BoolVar(&cmd.json, "j", false, "Print problems as JSON lines")
+
+	args.Var(&cmd.url, "url", "Gopher URL of a menu")
+}
+
+func (cmd *checkCommand) Run(ctx cmdy.Context) error {
+	start := cmd.url.URL()
+	if !crawl.IsMenu(start) {
+		return cmdy.ErrWithCode(cmdy.ExitUsage, fmt.Errorf("%s is not a menu", start))
+	}
+
+	client, done, err := cmd.Client(ctx)
+	defer done()
+	if err != nil {
+		return err
+	}
+
+	depth := 1
+	if cmd.recursive {
+		depth = cmd.depth
+	}
+
+	crawler := &crawl.Crawler{
+		Client:    client,
+		ClientFor: cmd.pins.Client,
+		Workers:   cmd.workers,
+		MaxDepth:  depth,
+		Delay:     cmd.delay,
+		MaxRead:   checkMaxRead,
+		Robots:    cmd.robotsSource(client, cmd.pins),
+		Follow: func(u gopher.URL, parent *crawl.Item) bool {
+			// Every link is checked, but only the links in menus on the server being
+			// checked:
+			return strings.EqualFold(parent.URL.Host(), start.Host())
+		},
+	}
+
+	out := ctx.Stdout()
+	enc := json.NewEncoder(out)
+	var checked, problems, code int
+	crawler.Visit = func(rs *crawl.Result) error {
+		if rs.Err != crawl.ErrRobots {
+			checked++
+		}
+		for _, p := range linkcheck.Check(rs) {
+			problems++
+			if c := exitCode(p.Status, 2); c > code {
+				code = c
+			}
+			if cmd.json {
+				if err := enc.Encode(p); err != nil {
+					return err
+				}
+			} else {
+				fmt.Fprintln(out, p)
+			}
+		}
+		return nil
+	}
+
+	began := time.Now()
+	if err := crawler.Crawl(ctx, start); err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stderr(), "checked %d URLs, %d problem(s), in %s\n", checked, problems, time.Since(began).Round(time.Millisecond))
+
+	if problems > 0 {
+		return cmdy.ErrWithCode(code, fmt.Errorf("%d problem(s) found in %s", problems, start))
+	}
+	return nil
+}
@@ -3,21 +3,23 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
-	"sync/atomic"
 	"time"
 
 	"github.com/cretz/bine/tor"
 	"github.com/shabbyrobe/cmdy"
 	"github.com/shabbyrobe/cmdy/arg"
 	"github.com/shabbyrobe/cmdy/flags"
+	"github.com/shabbyrobe/fur/internal/cache"
 	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/fur/internal/timing"
+	"github.com/shabbyrobe/fur/internal/tofu"
 	"github.com/shabbyrobe/furlib/gopher"
 )
 
@@ -55,6 +57,8 @@ func (uv *urlVar) Set(s string) error {
 	return nil
 }
 
+func newCommand() cmdy.Command { return &command{} }
+
 type command struct {
 	timeout time.Duration
 	url     urlVar
@@ -75,23 +79,44 @@ type command struct {
 	htmlMode    string
 	upscale     bool
 	insecure    bool
+	useCaps     bool
+	up          bool
+	crumbs      bool
 	lcut        int
 	include     flags.StringList
 	exclude     flags.StringList
 	maxEmpty    int
 	cols        int
 	ballFile    string
-	ball        *furball.Ball
+	recorder    gopher.Recorder
+	tracer      *timing.Tracer
+	tofuPolicy  string
+	pins        *tofu.Store
 	tor         bool
+	interactive bool
+	numbered    bool
 	spam        int
 	spamWorkers int
+	progress    time.Duration
+	rps         float64
+	duration    time.Duration
+	ramp        time.Duration
+	workload    string
+	replay      string
 	stats       bool
+
+	cacheEnabled  bool
+	cacheDisabled bool
+	cacheRefresh  bool
+	cacheTTL      time.Duration
+	cache         *cache.Cache
+	cacheLog      io.Writer
 }
 
 func (cmd *command) Help() cmdy.Help {
 	return cmdy.Help{
 		Synopsis: "Fur - CLI Gopher Client",
-		Usage:    commandUsage,
+		Usage:    commandUsage + subcommandUsage(),
 		Examples: cmdy.Examples{
 			cmdy.Example{
 				Desc:    "Visit Gopherpedia (Wikipedia)",
@@ -105,6 +130,10 @@ func (cmd *command) Help() cmdy.Help {
 				Desc:    "Directory of gopher servers",
 				Command: "gopher://gopher.floodgap.com/1/world",
 			},
+			cmdy.Example{
+				Desc:    "Go to the menu above a directory, using the server's caps.txt",
+				Command: "-up -caps gopher://gopher.floodgap.com/1/gopher/clients",
+			},
 			cmdy.Example{
 				Desc:    "Visit SDF Public Access UNIX System",
 				Command: "sdf.org",
@@ -131,12 +160,70 @@ func (cmd *command) Help() cmdy.Help {
 }
 
 func (cmd *command) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	cmd.configureFlags(flags)
+
+	args.VarOptional(&cmd.url, "url", "Gopher url (e.g. 'gopher://gopher.floodgap.com'). Scheme is optional. Can also use the alias 'search' to search against Veronica2.")
+	args.StringOptional(&cmd.search, "search", "", "Search (overrides search portion of URL)")
+}
+
+// configureClientFlags adds the flags used by Client. Commands that make requests but
+// don't render them can use this instead of configureFlags.
+func (cmd *command) configureClientFlags(flags *cmdy.FlagSet) {
+	flags.BoolVar(&cmd.insecure, "noverify", false, "Insecure TLS - skip hostname verification. Certificates are still pinned unless -tofu=off is passed.")
+	flags.BoolVar(&cmd.tor, "tor", false, "Connect via TOR (VERY slow)")
+	flags.BoolVar(&cmd.tlsInsist, "tls", false, "Insist on TLS")
+	flags.BoolVar(&cmd.tlsDisabled, "notls", false, "Do not attempt to automatically connect using TLS")
+	flags.StringVar(&cmd.tofuPolicy, "tofu", string(tofu.Strict), "What to do when a server's TLS certificate has changed since it was first seen: 'strict' refuses to connect, 'warn' warns, 'off' doesn't pin certificates. Applies even with -noverify. See 'fur tofu'.")
+	flags.BoolVar(&cmd.useCaps, "caps", false, "Fetch the server's caps.txt and use it, i.e. to find the TLS port for gophers:// URLs. See 'fur caps'.")
+	flags.DurationVar(&cmd.timeout, "t", 20*time.Second, "Timeout")
+}
+
+// configureFlags adds the flags for the command without the args, so that subcommands
+// that end up fetching and rendering a URL can share them.
+func (cmd *command) configureFlags(flags *cmdy.FlagSet) {
+	cmd.configureClientFlags(flags)
+	cmd.configureRenderFlags(flags)
+
+	flags.StringVar(&cmd.ballFile, "ball", "", ``+
+		`Append request to this furball (like HAR, but crappier; see 'fur ball export')`)
+
+	flags.BoolVar(&cmd.meta, "meta", false, "Request GopherIIbis metadata for this file")
+	flags.BoolVar(&cmd.interactive, "i", false, "Interactive mode; follow links by number, 'b'/'f' for history. Type '?' for help once started.")
+	flags.BoolVar(&cmd.up, "up", false, "Go to the menu above the URL instead of the URL itself. Uses the server's caps.txt path rules with -caps.")
+	flags.BoolVar(&cmd.allMeta, "allmeta", false, "Request GopherIIbis metadata for the entire directory")
+	flags.BoolVar(&cmd.stats, "stats", true, "Print stats to stderr after render")
+	flags.StringVar(&cmd.search, "search", "", "Search (overrides URL)")
+	flags.StringVar(&cmd.format, "format", "", "GopherIIbis 'format' (content-typeish) request. Not valid with -search")
+
+	flags.BoolVar(&cmd.cacheEnabled, "cache", false, "Cache responses on disk. See 'fur cache' to manage the cache.")
+	flags.BoolVar(&cmd.cacheDisabled, "nocache", false, "Do not use the cache. Takes precedence over -cache.")
+	flags.BoolVar(&cmd.cacheRefresh, "refresh", false, "Ignore cached responses, but still cache new ones. Implies -cache.")
+	flags.DurationVar(&cmd.cacheTTL, "cachettl", 1*time.Hour, "Use cached responses younger than this (0 = forever)")
+
+	flags.IntVar(&cmd.spam, "spam", 0, ""+
+		"Spam the URL with this many requests, print stats. Similar to 'ab'. Don't use on servers that aren't yours to spam.")
+	flags.IntVar(&cmd.spamWorkers, "workers", 10, ""+
+		"Number of workers to use when spamming.")
+	flags.Float64Var(&cmd.rps, "rps", 0, ""+
+		"When spamming, send this many requests per second whether or not earlier ones have finished, instead of as many as -workers can manage. -workers limits how many can be in flight at once.")
+	flags.DurationVar(&cmd.duration, "duration", 0, ""+
+		"Spam the URL for this long. With -spam, stops at whichever comes first.")
+	flags.DurationVar(&cmd.ramp, "ramp", 0, ""+
+		"When spamming, ramp up to -rps over this long, or start -workers gradually over this long without -rps.")
+	flags.StringVar(&cmd.workload, "workload", "", ""+
+		"Spam the URLs listed in this file instead of <url>, picked at random by weight. Each line is '[<weight>] <url>[<TAB><search>]'.")
+	flags.StringVar(&cmd.replay, "replay", "", ""+
+		"Spam the requests recorded in this furball instead of <url>, once each, with the same timing as when they were recorded.")
+	flags.DurationVar(&cmd.progress, "progress", 1*time.Second, ""+
+		"Print progress to stderr this often when spamming (0 = never). The final report is printed to stdout, as JSON with -j.")
+}
+
+// configureRenderFlags adds the flags that control how responses are rendered.
+func (cmd *command) configureRenderFlags(flags *cmdy.FlagSet) {
 	flags.BoolVar(&cmd.raw, "raw", false, ``+
 		`Raw mode; bypass all fancy rendering and print the raw bytes off the wire (will include '.\r\n' termination lines if present). Exclusive with -txt.`)
 	flags.BoolVar(&cmd.txt, "txt", false, ``+
 		`Raw text mode; bypass all fancy rendering, but decode as text (dot-escaped). Exclusive with -raw.`)
-	flags.StringVar(&cmd.ballFile, "ball", "", ``+
-		`Append request to this furball (like HAR, but crappier)`)
 
 	// Useful for servers that misuse the '1' item type and just prepend 'i' to every line
 	// of a random file regardless of what it contains:
@@ -145,31 +232,15 @@ func (cmd *command) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
 	flags.IntVar(&cmd.cols, "cols", 0, "Wrap columns, 0 to detect")
 	flags.IntVar(&cmd.maxEmpty, "maxempty", 2, "Maximum number of empty 'i' lines to print in a row (0 = unlimited)")
 	flags.BoolVar(&cmd.upscale, "upscale", true, "Upscale images")
-	flags.BoolVar(&cmd.insecure, "noverify", false, "Insecure TLS - skip hostname verification")
 	flags.BoolVar(&cmd.json, "j", false, "Render as JSON; will show base64 for binary, string for text and jsonl/ndjson for directories")
-	flags.BoolVar(&cmd.meta, "meta", false, "Request GopherIIbis metadata for this file")
-	flags.BoolVar(&cmd.tor, "tor", false, "Connect via TOR (VERY slow)")
-	flags.BoolVar(&cmd.allMeta, "allmeta", false, "Request GopherIIbis metadata for the entire directory")
+	flags.BoolVar(&cmd.crumbs, "crumbs", true, "Show a breadcrumb trail above directories")
+	flags.BoolVar(&cmd.numbered, "num", true, "Number links in directories. Use 'fur go <n>' to follow them.")
 	flags.BoolVar(&cmd.outAutoFile, "O", false, "Output to file, infer name from selector")
-	flags.BoolVar(&cmd.stats, "stats", true, "Print stats to stderr after render")
-	flags.BoolVar(&cmd.tlsInsist, "tls", false, "Insist on TLS")
-	flags.BoolVar(&cmd.tlsDisabled, "notls", false, "Do not attempt to automatically connect using TLS")
-	flags.DurationVar(&cmd.timeout, "t", 20*time.Second, "Timeout")
 	flags.StringVar(&cmd.outFile, "o", "", "Output file")
-	flags.StringVar(&cmd.search, "search", "", "Search (overrides URL)")
-	flags.StringVar(&cmd.format, "format", "", "GopherIIbis 'format' (content-typeish) request. Not valid with -search")
 	flags.StringVar(&cmd.w3m, "w3m", "", "Path to w3m for HTML rendering (detects)")
 	flags.StringVar(&cmd.htmlMode, "html", "godown", "HTML mode (godown, w3m)")
-	flags.Var(&cmd.include, "ti", "Include these item types. Pass as a string, no spaces or commas. Can pass multiple times. -x=12 is the same as -x=1 -x=2")
-	flags.Var(&cmd.exclude, "tx", "Exclude these item types. Takes precedence over -i. See -i for details.")
-
-	flags.IntVar(&cmd.spam, "spam", 0, ""+
-		"Spam the URL with this many requests, print stats. Similar to 'ab'. Don't use on servers that aren't yours to spam.")
-	flags.IntVar(&cmd.spamWorkers, "workers", 10, ""+
-		"Number of workers to use when spamming.")
-
-	args.Var(&cmd.url, "url", "Gopher url (e.g. 'gopher://gopher.floodgap.com'). Scheme is optional. Can also use the alias 'search' to search against Veronica2.")
-	args.StringOptional(&cmd.search, "search", "", "Search (overrides search portion of URL)")
+	flags.Var(&cmd.include, "ti", "Include these item types. Pass as a string, no spaces or commas. Can pass multiple times. -ti=12 is the same as -ti=1 -ti=2")
+	flags.Var(&cmd.exclude, "tx", "Exclude these item types. Takes precedence over -ti. See -ti for details.")
 }
 
 func (cmd *command) URL() (gopher.URL, error) {
@@ -188,7 +259,7 @@ func (cmd *command) URL() (gopher.URL, error) {
 	return u, nil
 }
 
-func (cmd *command) Client(ctx context.Context) (*gopher.Client, DoneFunc, error) {
+func (cmd *command) Client(ctx cmdy.Context) (*gopher.Client, DoneFunc, error) {
 	done := nilDone
 	client := &gopher.Client{
 		Timeout: cmd.timeout,
@@ -199,8 +270,8 @@ func (cmd *command) Client(ctx context.Context) (*gopher.Client, DoneFunc, error
 	} else if cmd.tlsDisabled {
 		client.TLSMode = gopher.TLSDisabled
 	}
-	if cmd.ball != nil {
-		client.Recorder = cmd.ball // 'nil interface' hazard
+	if cmd.recorder != nil {
+		client.Recorder = cmd.recorder
 	}
 	if cmd.insecure {
 		client.TLSClientConfig = &tls.Config{
@@ -208,6 +279,17 @@ func (cmd *command) Client(ctx context.Context) (*gopher.Client, DoneFunc, error
 		}
 	}
 
+	policy, err := tofu.ParsePolicy(cmd.tofuPolicy)
+	if err != nil {
+		return nil, done, cmdy.ErrWithCode(cmdy.ExitUsage, err)
+	}
+	if policy != tofu.Off {
+		if cmd.pins, err = loadPins(policy); err != nil {
+			return nil, done, err
+		}
+		cmd.pins.Log = ctx.Stderr()
+	}
+
 	if cmd.tor {
 		t, err := tor.Start(nil, nil)
 		if err != nil {
@@ -222,6 +304,16 @@ func (cmd *command) Client(ctx context.Context) (*gopher.Client, DoneFunc, error
 		done = func() { t.Close() }
 	}
 
+	if cmd.useCaps {
+		src, err := newCapsSource(client, cmd.pins)
+		if err != nil {
+			return nil, done, err
+		}
+		client.CapsSource = src
+	}
+
+	cmd.tracer = timing.Install(client)
+
 	return client, done, nil
 }
 
@@ -230,61 +322,74 @@ func (cmd *command) outFileName(u gopher.URL) string {
 		return cmd.outFile
 
 	} else if cmd.outAutoFile {
-		base := path.Base(u.Selector)
-		if base == "" || base == "/" || base == "." {
-			return ""
-		}
-
-		wd, err := os.Getwd()
-		if err != nil {
-			panic(err)
-		}
-
-		curBase := base
-		for i := 1; ; i++ {
-			full := filepath.Join(wd, curBase)
-			if _, err := os.Stat(full); errors.Is(err, os.ErrNotExist) {
-				return curBase
-			}
-			curBase = fmt.Sprintf("%s.%d", base, i)
-		}
+		return autoFileName(u)
 
 	} else {
 		return ""
 	}
 }
 
-func (cmd *command) Run(ctx cmdy.Context) (err error) {
-	if cmd.spam <= 0 && cmd.ballFile != "" {
-		cmd.ball, err = furball.LoadBallFile(cmd.ballFile)
-		if err != nil && !errors.Is(err, os.ErrNotExist) {
-			return fmt.Errorf("fur: could not load ball %q: %w", cmd.ball, err)
-		}
-		if cmd.ball == nil {
-			cmd.ball = &furball.Ball{}
+// autoFileName infers a file name for the URL from the selector that doesn't clash with
+// any file in the working directory. Returns an empty string if no name can be inferred.
+func autoFileName(u gopher.URL) string {
+	base := path.Base(u.Selector)
+	if base == "" || base == "/" || base == "." {
+		return ""
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+
+	curBase := base
+	for i := 1; ; i++ {
+		full := filepath.Join(wd, curBase)
+		if _, err := os.Stat(full); errors.Is(err, os.ErrNotExist) {
+			return curBase
 		}
+		curBase = fmt.Sprintf("%s.%d", base, i)
+	}
+}
+
+func (cmd *command) Run(ctx cmdy.Context) (err error) {
+	if cmd.url.URL().IsEmpty() && cmd.workload == "" && cmd.replay == "" {
+		return cmdy.ErrWithCode(cmdy.ExitUsage, fmt.Errorf("missing <url>"))
+	}
 
-		n := len(cmd.ball.Entries)
+	if !cmd.spamming() && cmd.ballFile != "" {
+		done, err := cmd.openBall(ctx)
+		if err != nil {
+			return err
+		}
 		defer func() {
-			if len(cmd.ball.Entries) != n {
-				if serr := furball.SaveBallFile(cmd.ball, cmd.ballFile); serr != nil && err == nil {
-					err = serr
-				}
+			if derr := done(); derr != nil && err == nil {
+				err = derr
 			}
 		}()
 	}
 
-	if cmd.spam > 0 {
+	// GopherIIbis format requests aren't part of the URL, so they can't be cached:
+	useCache := (cmd.cacheEnabled || cmd.cacheRefresh) && !cmd.cacheDisabled && cmd.format == ""
+	if useCache && !cmd.spamming() {
+		cmd.cache, err = openResponseCache(cmd.cacheTTL)
+		if err != nil {
+			return err
+		}
+		cmd.cacheLog = ctx.Stderr()
+	}
+
+	if cmd.spamming() {
 		return cmd.runSpam(ctx)
 	} else if cmd.raw {
 		return cmd.runRaw(ctx, true)
 	} else if cmd.txt {
 		return cmd.runRaw(ctx, false)
+	} else if cmd.interactive {
+		return cmd.runInteractive(ctx)
 	} else {
 		return cmd.runClient(ctx)
 	}
-
-	return nil
 }
 
 func (cmd *command) itemSet() [256]bool {
@@ -353,7 +458,7 @@ func (cmd *command) selectTextRenderer(rs gopher.Response) (rnd renderer, allowD
 	allowDefaultStdout = true
 	switch rs.(type) {
 	case *gopher.DirResponse:
-		rnd = &dirRenderer{maxEmpty: cmd.maxEmpty, items: cmd.itemSet(), cols: cols}
+		rnd = &dirRenderer{maxEmpty: cmd.maxEmpty, items: cmd.itemSet(), cols: cols, numbered: cmd.numbered || cmd.interactive}
 
 	case *gopher.TextResponse:
 		switch url.ItemType {
@@ -400,13 +505,54 @@ func (cmd *command) request(u gopher.URL) (rq *gopher.Request, err error) {
 	return rq, nil
 }
 
-func (cmd *command) runClient(ctx cmdy.Context) (rerr error) {
-	u, err := cmd.URL()
+// trace times rq using the Trace in ctx, or a new one if there isn't one, so the
+// timing can be recorded in the -ball file. rq must be sent with the returned context.
+func (cmd *command) trace(ctx context.Context, rq *gopher.Request) context.Context {
+	tr := timing.FromContext(ctx)
+	if tr == nil {
+		tr = &timing.Trace{}
+		ctx = timing.WithTrace(ctx, tr)
+	}
+	if cmd.tracer != nil {
+		cmd.tracer.Track(rq, tr)
+	}
+	return ctx
+}
+
+// fetch requests the URL using the client. If the server responds with an error, the
+// error will contain the exit code that corresponds to the status.
+func (cmd *command) fetch(ctx context.Context, client *gopher.Client, u gopher.URL) (gopher.Response, error) {
+	u, err := cmd.capsTLSPort(ctx, client, u)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	client = cmd.pins.Client(client, u)
 
 	rq, err := cmd.request(u)
+	if err != nil {
+		return nil, err
+	}
+	ctx = cmd.trace(ctx, rq)
+
+	var gopherErr *gopher.Error
+	var rs gopher.Response
+
+	if cmd.cache != nil {
+		rs, err = cmd.fetchCached(ctx, client, rq)
+	} else {
+		rs, err = client.Fetch(ctx, rq)
+		timing.FromContext(ctx).Received()
+	}
+	if errors.As(err, &gopherErr) {
+		return nil, cmdy.ErrWithCode(exitCode(gopherErr.Status, 2), err)
+	} else if err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+func (cmd *command) runClient(ctx cmdy.Context) (rerr error) {
+	u, err := cmd.URL()
 	if err != nil {
 		return err
 	}
@@ -417,14 +563,17 @@ func (cmd *command) runClient(ctx cmdy.Context) (rerr error) {
 		return err
 	}
 
-	var gopherErr *gopher.Error
+	if cmd.up {
+		if u, err = cmd.parentURL(ctx, client, u); err != nil {
+			return err
+		}
+	}
 
 	start := time.Now()
 
-	rs, err := client.Fetch(ctx, rq)
-	if errors.As(err, &gopherErr) {
-		return cmdy.ErrWithCode(exitCode(gopherErr.Status, 2), err)
-	} else if err != nil {
+	tr := &timing.Trace{}
+	rs, err := cmd.fetch(timing.WithTrace(ctx, tr), client, u)
+	if err != nil {
 		return err
 	}
 	defer DeferClose(&rerr, rs)
@@ -433,6 +582,7 @@ func (cmd *command) runClient(ctx cmdy.Context) (rerr error) {
 	if err != nil {
 		return err
 	}
+	cmd.addCrumbs(ctx, client, rnd, u)
 
 	outFile := cmd.outFileName(u)
 	out, isFile, err := stdoutOrFileWriter(ctx.Stdout(), outFile, allowDefaultStdout)
@@ -446,16 +596,46 @@ func (cmd *command) runClient(ctx cmdy.Context) (rerr error) {
 	}
 
 	if err := rnd.Render(out, rs); err != nil {
-		return nil
+		return err
+	}
+
+	if drnd, ok := rnd.(*dirRenderer); ok {
+		cmd.saveBrowseState(ctx, u, drnd.links)
 	}
 
 	taken := time.Since(start)
 	if cmd.stats {
-		fmt.Fprintf(ctx.Stderr(), "  -- took %s, tls: %v --  \n", taken, rs.Info().TLS != nil)
+		return cmd.printStats(ctx.Stderr(), taken, rs.Info().TLS != nil, tr)
 	}
 	return nil
 }
 
+// printStats prints how long the request took, broken down by phase unless the
+// response was cached, to stderr. With -j, the stats are printed as a JSON object.
+func (cmd *command) printStats(w io.Writer, taken time.Duration, isTLS bool, tr *timing.Trace) error {
+	phases, timed := tr.Timing()
+	if cmd.json {
+		stats := struct {
+			Took   furball.Duration `json:"took"`
+			TLS    bool             `json:"tls"`
+			Timing *furball.Timing  `json:"timing,omitempty"`
+		}{Took: furball.Duration(taken), TLS: isTLS}
+		if timed {
+			stats.Timing = &phases
+		}
+		return json.NewEncoder(w).Encode(stats)
+	}
+
+	if !timed {
+		_, err := fmt.Fprintf(w, "  -- took %s, tls: %v --  \n", taken, isTLS)
+		return err
+	}
+	us := func(d furball.Duration) time.Duration { return time.Duration(d).Round(time.Microsecond) }
+	_, err := fmt.Fprintf(w, "  -- took %s, tls: %v (dns %s, connect %s, handshake %s, ttfb %s, transfer %s) --  \n",
+		taken, isTLS, us(phases.DNS), us(phases.Connect), us(phases.TLS), us(phases.TTFB), us(phases.Transfer))
+	return err
+}
+
 func (cmd *command) runRaw(ctx cmdy.Context, bin bool) (rerr error) {
 	client, done, err := cmd.Client(ctx)
 	defer done()
@@ -468,17 +648,30 @@ func (cmd *command) runRaw(ctx cmdy.Context, bin bool) (rerr error) {
 		return err
 	}
 
+	if cmd.up {
+		if u, err = cmd.parentURL(ctx, client, u); err != nil {
+			return err
+		}
+	}
+
+	u, err = cmd.capsTLSPort(ctx, client, u)
+	if err != nil {
+		return err
+	}
+	client = cmd.pins.Client(client, u)
+
 	rq, err := cmd.request(u)
 	if err != nil {
 		return err
 	}
 
-	rs, err := client.Raw(ctx, rq)
+	tctx := cmd.trace(ctx, rq)
+	rs, err := client.Raw(tctx, rq)
 	if err != nil {
 		return err
 	}
 	defer rs.Close()
-	var rdr io.Reader = rs.Reader()
+	var rdr io.Reader = timing.FromContext(tctx).Reader(rs.Reader())
 	if !bin {
 		rdr = gopher.NewTextReader(rdr)
 	}
@@ -506,123 +699,6 @@ func (cmd *command) runRaw(ctx cmdy.Context, bin bool) (rerr error) {
 	return nil
 }
 
-func (cmd *command) runSpam(ctx cmdy.Context) (rerr error) {
-	// XXX: this is a cheap and nasty rough cut of a spammer; it needs a lot of extra
-	// work.
-
-	if cmd.spamWorkers <= 0 {
-		return fmt.Errorf("spam workers must be > 0")
-	}
-
-	u, err := cmd.URL()
-	if err != nil {
-		return err
-	}
-
-	client, done, err := cmd.Client(ctx)
-	defer done()
-	if err != nil {
-		return err
-	}
-
-	if client.TLSClientConfig == nil {
-		client.TLSClientConfig = &tls.Config{}
-	}
-	client.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1000)
-
-	stderr := ctx.Stderr()
-
-	var (
-		failedRequest int64
-		failedGeneral int64
-		failedRead    int64
-		totalUsec     int64 // fixme: usec might even be too coarse
-	)
-
-	// FIXME: grab should handle stats and report progress
-	grab := func() {
-		var gopherErr *gopher.Error
-		start := time.Now()
-		rq, err := cmd.request(u)
-		if err != nil {
-			panic(err)
-		}
-
-		rs, err := client.Fetch(ctx, rq)
-		if errors.As(err, &gopherErr) {
-			atomic.AddInt64(&failedRequest, 1)
-
-		} else if err != nil {
-			atomic.AddInt64(&failedGeneral, 1)
-
-		} else if rs != nil {
-			if _, err := io.Copy(ioutil.Discard, rs.Reader()); err != nil {
-				atomic.AddInt64(&failedRead, 1)
-			}
-			rs.Close()
-		}
-		took := time.Since(start)
-		atomic.AddInt64(&totalUsec, int64(took/time.Microsecond))
-	}
-
-	fmt.Fprintf(stderr, "spamming %d requests with %d workers\n", cmd.spam, cmd.spamWorkers)
-	fmt.Fprintf(stderr, "%q\n", u)
-
-	var left = int64(cmd.spam)
-	var workerDone = make(chan struct{}, cmd.spamWorkers)
-	var progress = make(chan int64)
-
-	for i := 0; i < cmd.spamWorkers; i++ {
-		go func() {
-			defer func() {
-				workerDone <- struct{}{}
-			}()
-			for {
-				n := atomic.AddInt64(&left, -1)
-				if n <= 0 {
-					break
-				}
-				grab()
-			}
-		}()
-	}
-
-	printStats := func(rqLeft int64) {
-		n := int64(cmd.spam) - rqLeft
-		usec := atomic.LoadInt64(&totalUsec)
-		if usec == 0 {
-			usec = 1
-		}
-		avg := float64(usec) / float64(n) / 1000
-		tps := float64(n) / (float64(usec) / float64(cmd.spamWorkers) / 1000000)
-		fmt.Printf("%d avgms:%.2f tps:%.0f\n", n, avg, tps)
-	}
-
-	workersLeft := cmd.spamWorkers
-	for workersLeft > 0 {
-		select {
-		case pleft := <-progress:
-			printStats(pleft)
-
-		case <-workerDone:
-			workersLeft--
-
-		case <-ctx.Done():
-			atomic.StoreInt64(&left, 0)
-		}
-	}
-
-	for workersLeft > 0 {
-		<-workerDone
-		workersLeft--
-	}
-
-	printStats(left)
-	fmt.Printf("failreq:%d failgen:%d failrd:%d\n", failedRequest, failedGeneral, failedRead)
-
-	return nil
-}
-
 type DoneFunc func()
 
 var nilDone DoneFunc = func() {}
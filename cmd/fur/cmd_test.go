@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
+	"net"
+	"strings"
 	"testing"
 
 	"github.com/shabbyrobe/cmdy"
 	"github.com/shabbyrobe/cmdy/cmdytest"
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/furlib/gopher"
 )
 
 func TestCommand(t *testing.T) {
@@ -22,3 +27,109 @@ func TestCommand(t *testing.T) {
 		tester.TestExample(t, ex)
 	}
 }
+
+func TestSubcommands(t *testing.T) {
+	var testBuilders func(prefix string, bldrs cmdy.Builders)
+	testBuilders = func(prefix string, bldrs cmdy.Builders) {
+		for name, bld := range bldrs {
+			if grp, ok := bld().(*cmdy.Group); ok {
+				testBuilders(prefix+" "+name, grp.Builders)
+				continue
+			}
+			tester := cmdytest.ExampleTester{
+				TestName: prefix + " " + name,
+				Builder:  bld,
+			}
+			tester.TestExamples(t)
+		}
+	}
+	testBuilders("fur", subcommands())
+}
+
+// TestBallServe runs fur against a furball served on a local port, so it can touch the
+// network without depending on anything outside the test.
+func TestBallServe(t *testing.T) {
+	ball := &furball.Ball{Entries: []furball.Entry{
+		{In: []byte("/hello\r\n"), Out: []byte("hello\r\n.\r\n")},
+		{URL: gopher.URL{Selector: "/search", Search: "foo"}, Out: []byte("foo\r\n.\r\n")},
+		{In: []byte("/hello\r\n"), Out: []byte("hello again\r\n.\r\n")},
+		{In: []byte("/err\r\n"), Out: []byte("3Gone away\t\terror.invalid\t0\r\n.\r\n")},
+	}}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &gopher.Server{Handler: furball.NewHandler(ball)}
+	go srv.Serve(ln, "")
+	defer srv.Close()
+
+	for idx, tc := range []struct {
+		path string
+		out  string // Contained in the JSON output
+		code int
+	}{
+		{"/0/hello", "hello again", 0},
+		{"/0/search%09foo", "foo", 0},
+		{"/0/err", "", exitCode(gopher.StatusGeneralError, 2)},
+		{"/0/missing", "", exitCode(gopher.StatusGeneralError, 2)},
+	} {
+		t.Run("", func(t *testing.T) {
+			runner := cmdy.NewBufferedRunner()
+			args := []string{"-j", "gopher://" + ln.Addr().String() + tc.path}
+			err := runner.Run(context.Background(), "fur", args, newCommand)
+			if code := cmdy.ErrCode(err); code != tc.code {
+				t.Fatal(idx, "code", code, "!=", tc.code, err)
+			}
+			if out := runner.StdoutBuffer.String(); !strings.Contains(out, tc.out) {
+				t.Fatalf("%d: %q does not contain %q", idx, out, tc.out)
+			}
+		})
+	}
+}
+
+func TestParentURLWithoutCaps(t *testing.T) {
+	var cmd command
+	for idx, tc := range []struct {
+		in     string
+		parent string
+		ok     bool
+	}{
+		{"/a/b", "/a", true},
+		{"/a/b/", "/a", true},
+		{"/a", "", true},
+		{"foo/bar", "foo", true},
+		{"foo/bar/baz", "foo/bar", true},
+		{"foo", "", true},
+		{"/", "", false},
+	} {
+		u := gopher.URL{Hostname: "localhost", ItemType: gopher.Text, Selector: tc.in}
+		parent, err := cmd.parentURL(context.Background(), nil, u)
+		if (err == nil) != tc.ok {
+			t.Fatal(idx, tc.in, err)
+		} else if err == nil && parent.Selector != tc.parent {
+			t.Fatal(idx, tc.in, parent.Selector, "!=", tc.parent)
+		}
+	}
+}
+
+func TestEntryKey(t *testing.T) {
+	for idx, tc := range []struct {
+		a, b string
+		same bool
+	}{
+		{"gopher://localhost/1/foo", "gopher://localhost:70/1/foo", true},
+		{"gopher://localhost/1/foo", "gophers://LocalHost/1/foo", true},
+		{"gopher://localhost/1/foo", "gopher://localhost/0/foo", true},
+		{"gopher://localhost", "gopher://localhost/1", true},
+		{"gopher://localhost/7/foo%09bar", "gopher://localhost/7/foo%09bar", true},
+		{"gopher://localhost/7/foo%09bar", "gopher://localhost/7/foo%09baz", false},
+		{"gopher://localhost/1/foo", "gopher://localhost:7070/1/foo", false},
+		{"gopher://localhost/1/foo", "gopher://localhost/1/Foo", false},
+	} {
+		a, b := entryKey(gopher.MustParseURL(tc.a)), entryKey(gopher.MustParseURL(tc.b))
+		if (a == b) != tc.same {
+			t.Fatalf("%d: %q, %q", idx, a, b)
+		}
+	}
+}
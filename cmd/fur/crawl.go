@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+	"github.com/shabbyrobe/cmdy/flags"
+	"github.com/shabbyrobe/fur/internal/cache"
+	"github.com/shabbyrobe/fur/internal/crawl"
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const crawlUsage = `
+Fetch a URL and everything linked from it, breadth-first, writing each response to a
+furball (-ball) and/or a directory of flatdump files (-store), which uses the same
+layout as the response cache. Prints a line for each URL fetched.
+
+Only links to the hosts of the start URLs are followed unless -host is passed. Hosts
+are 'host' or 'host:port', and may contain '*' wildcards, so -host='*' follows links
+anywhere. Don't do that to servers that aren't yours.
+
+Each server's robots.txt is fetched before anything else, and URLs it disallows for
+'fur' (or '*') are skipped. A Crawl-delay longer than -delay is honoured. Pass
+-norobots to ignore robots.txt when crawling your own servers.
+
+Pass -state to record the progress of the crawl, so that running the same command
+again resumes it if it was interrupted. When the crawl finishes, running it again does
+nothing until the state file is removed. Use a JSONL or directory furball for long
+crawls, as JSON furballs are only written when the crawl stops.
+`
+
+type crawlCommand struct {
+	command
+	robotsFlags
+	start     []string
+	depth     int
+	workers   int
+	delay     time.Duration
+	limit     int
+	allow     flags.StringList
+	deny      flags.StringList
+	storeDir  string
+	stateFile string
+}
+
+func newCrawlCommand() cmdy.Command { return &crawlCommand{} }
+
+func (cmd *crawlCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Crawl a gopherhole",
+		Usage:    crawlUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Crawl two levels deep into a furball", Command: "-depth=2 -ball=crawl.jsonl gopher://localhost/"},
+			cmdy.Example{Desc: "Crawl menus and text only", Command: "-ti=01 -ball=crawl.jsonl gopher://localhost/"},
+			cmdy.Example{Desc: "Resumable crawl", Command: "-state=crawl.state -ball=crawl/ gopher://localhost/"},
+		},
+	}
+}
+
+func (cmd *crawlCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	cmd.command.configureClientFlags(flags)
+	cmd.configureRobotsFlags(flags)
+
+	flags.IntVar(&cmd.depth, "depth", 3, "Follow links this many menus deep; 0 only fetches the start URLs")
+	flags.IntVar(&cmd.workers, "workers", 4, "Number of URLs to fetch at once")
+	flags.DurationVar(&cmd.delay, "delay", 1*time.Second, "Minimum time between requests to the same host")
+	flags.IntVar(&cmd.limit, "limit", 0, "Stop after fetching this many URLs (0 = unlimited)")
+	flags.Var(&cmd.allow, "host", "Follow links to this host. Can pass multiple times. Defaults to the hosts of the start URLs.")
+	flags.Var(&cmd.deny, "nohost", "Don't follow links to this host. Takes precedence over -host.")
+	flags.Var(&cmd.include, "ti", "Follow links of these item types. Pass as a string, no spaces or commas. Can pass multiple times.")
+	flags.Var(&cmd.exclude, "tx", "Don't follow links of these item types. Takes precedence over -ti.")
+	flags.StringVar(&cmd.ballFile, "ball", "", "Write responses to this furball")
+	flags.StringVar(&cmd.storeDir, "store", "", "Write responses to flatdump files in this directory")
+	flags.StringVar(&cmd.stateFile, "state", "", "Record progress in this file, and resume from it if it exists")
+
+	args.Remaining(&cmd.start, "url", arg.AnyLen, "Gopher URLs to start from")
+}
+
+// hostMatches reports whether u is on host, which is a 'host' or 'host:port' pattern for
+// path.Match.
+func hostMatches(host string, u gopher.URL) bool {
+	host = strings.ToLower(host)
+	if ok, _ := path.Match(host, strings.ToLower(u.Hostname)); ok {
+		return true
+	}
+	ok, _ := path.Match(host, strings.ToLower(u.Host()))
+	return ok
+}
+
+func (cmd *crawlCommand) Run(ctx cmdy.Context) (rerr error) {
+	if len(cmd.start) == 0 {
+		return cmdy.ErrWithCode(cmdy.ExitUsage, fmt.Errorf("expected at least one URL"))
+	}
+	if cmd.ballFile == "" && cmd.storeDir == "" {
+		return cmdy.ErrWithCode(cmdy.ExitUsage, fmt.Errorf("-ball or -store is required"))
+	}
+
+	var start []gopher.URL
+	for _, s := range cmd.start {
+		var uv urlVar
+		if err := uv.Set(s); err != nil {
+			return cmdy.ErrWithCode(cmdy.ExitUsage, err)
+		}
+		start = append(start, uv.URL())
+	}
+
+	allow := cmd.allow
+	if len(allow) == 0 {
+		for _, u := range start {
+			allow = append(allow, u.Host())
+		}
+	}
+	types := cmd.itemSet()
+
+	client, done, err := cmd.Client(ctx)
+	defer done()
+	if err != nil {
+		return err
+	}
+
+	var write func(e *furball.Entry) error
+	var closers []func() error
+	defer func() {
+		for _, close := range closers {
+			if err := close(); err != nil && rerr == nil {
+				rerr = err
+			}
+		}
+	}()
+
+	if cmd.ballFile != "" {
+		bw, err := openBallWriter(cmd.ballFile)
+		if err != nil {
+			return err
+		}
+		closers = append(closers, bw.Close)
+		write = bw.Append
+	}
+	if cmd.storeDir != "" {
+		store := cache.New(cmd.storeDir, 0)
+		ballWrite := write
+		write = func(e *furball.Entry) error {
+			if ballWrite != nil {
+				if err := ballWrite(e); err != nil {
+					return err
+				}
+			}
+			if e.Status != gopher.OK {
+				return nil
+			}
+			return store.Put(e.URL, e.At, e.Out)
+		}
+	}
+
+	crawler := &crawl.Crawler{
+		Client:    client,
+		ClientFor: cmd.pins.Client,
+		Workers:   cmd.workers,
+		MaxDepth:  cmd.depth,
+		Limit:     cmd.limit,
+		Delay:     cmd.delay,
+		Robots:    cmd.robotsSource(client, cmd.pins),
+		Follow: func(u gopher.URL, parent *crawl.Item) bool {
+			if !types[u.ItemType] {
+				return false
+			}
+			for _, host := range cmd.deny {
+				if hostMatches(host, u) {
+					return false
+				}
+			}
+			for _, host := range allow {
+				if hostMatches(host, u) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+
+	if cmd.stateFile != "" {
+		state, err := crawl.OpenState(cmd.stateFile)
+		if err != nil {
+			return err
+		}
+		closers = append(closers, state.Close)
+		crawler.State = state
+	}
+
+	log := newCrawlLog(ctx.Stdout())
+	crawler.Visit = func(rs *crawl.Result) error {
+		if !log.visit(rs) {
+			return nil
+		}
+		return write(rs.Entry)
+	}
+
+	err = crawler.Crawl(ctx, start...)
+	log.summary(ctx.Stderr())
+	return err
+}
+
+// crawlLog prints a line for each URL visited by a crawl, and a summary at the end.
+type crawlLog struct {
+	out     io.Writer
+	began   time.Time
+	fetched int
+	failed  int
+	skipped int
+}
+
+func newCrawlLog(out io.Writer) *crawlLog {
+	return &crawlLog{out: out, began: time.Now()}
+}
+
+// visit prints rs, and reports whether it has an entry that can be saved, even if the
+// server reported an error.
+func (cl *crawlLog) visit(rs *crawl.Result) bool {
+	if rs.Err == crawl.ErrRobots {
+		cl.skipped++
+		fmt.Fprintf(cl.out, "%-4s %d %8s %s\n", "skip", rs.Depth, "-", rs.URL)
+		return false
+	}
+	cl.fetched++
+	if rs.Entry == nil {
+		cl.failed++
+		fmt.Fprintf(cl.out, "%-4s %d %8s %s: %v\n", "err", rs.Depth, "-", rs.URL, rs.Err)
+		return false
+	}
+
+	status := "ok"
+	if rs.Entry.Status != gopher.OK {
+		status = fmt.Sprint(int(rs.Entry.Status))
+	}
+	if rs.Err != nil {
+		cl.failed++
+		fmt.Fprintf(cl.out, "%-4s %d %8d %s: %v\n", status, rs.Depth, len(rs.Entry.Out), rs.URL, rs.Err)
+	} else {
+		fmt.Fprintf(cl.out, "%-4s %d %8d %s\n", status, rs.Depth, len(rs.Entry.Out), rs.URL)
+	}
+	return true
+}
+
+// fail counts a URL that was fetched but couldn't be saved.
+func (cl *crawlLog) fail(err error) {
+	cl.failed++
+	fmt.Fprintf(cl.out, "%-4s %v\n", "err", err)
+}
+
+func (cl *crawlLog) summary(w io.Writer) {
+	taken := time.Since(cl.began).Round(time.Millisecond)
+	if cl.skipped > 0 {
+		fmt.Fprintf(w, "fetched %d URLs, %d failed, %d disallowed by robots.txt, in %s\n", cl.fetched, cl.failed, cl.skipped, taken)
+	} else {
+		fmt.Fprintf(w, "fetched %d URLs, %d failed, in %s\n", cl.fetched, cl.failed, taken)
+	}
+}
+
+// ballWriter appends entries to a furball as they arrive. JSON furballs are rewritten
+// in their entirety to append to them, so their entries are held until Close.
+type ballWriter struct {
+	path    string
+	app     *furball.Appender
+	entries []furball.Entry
+}
+
+func openBallWriter(path string) (*ballWriter, error) {
+	format, err := furball.DetectFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	bw := &ballWriter{path: path}
+	if format != furball.FormatJSON {
+		if bw.app, err = furball.OpenAppender(path); err != nil {
+			return nil, err
+		}
+	}
+	return bw, nil
+}
+
+func (bw *ballWriter) Append(e *furball.Entry) error {
+	if bw.app != nil {
+		return bw.app.Append(e)
+	}
+	bw.entries = append(bw.entries, *e)
+	return nil
+}
+
+func (bw *ballWriter) Close() error {
+	if bw.app != nil {
+		return bw.app.Close()
+	}
+	if len(bw.entries) == 0 {
+		return nil
+	}
+
+	// The crawl may have stopped because it was interrupted, but what was fetched
+	// should still be saved:
+	return furball.AppendBallFile(context.Background(), bw.path, bw.entries)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+	"github.com/shabbyrobe/fur/internal/cache"
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/fur/internal/gopherdiff"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const diffUsage = `
+Show what has changed in a gopherhole, either between the most recent response for a
+URL in a furball and the live response, or between the most recent responses for
+every URL in two furballs:
+
+    fur diff -ball=old.json <url>
+    fur diff old.json new.json
+
+Menus are compared by the items in them: each item that links somewhere is matched
+by its selector, host and port, and shown as added (+), removed (-) or changed (~) if
+its type or display string differs. Text is compared line by line, as a unified diff.
+Anything else is only compared by its hash and size.
+
+Exits with status 1 if anything has changed, like diff(1).
+`
+
+type diffCommand struct {
+	command
+	a, b    string
+	context int
+}
+
+func newDiffCommand() cmdy.Command { return &diffCommand{} }
+
+func (cmd *diffCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Compare responses across recordings, or with the live server",
+		Usage:    diffUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Compare a recording with the live server", Command: "-ball=old.json gopher://gopher.floodgap.com/1/world"},
+			cmdy.Example{Desc: "Compare two recordings", Command: "old.json new.json"},
+		},
+	}
+}
+
+func (cmd *diffCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	cmd.command.configureClientFlags(flags)
+
+	flags.StringVar(&cmd.ballFile, "ball", "", "Compare the live response for <url> with the most recent one in this furball")
+	flags.IntVar(&cmd.context, "context", 3, "Lines of context around changes to text")
+
+	args.String(&cmd.a, "a", "URL if -ball is passed, otherwise the old furball")
+	args.StringOptional(&cmd.b, "b", "", "New furball")
+}
+
+func (cmd *diffCommand) Run(ctx cmdy.Context) error {
+	var changed bool
+	var err error
+	if cmd.ballFile != "" {
+		if cmd.b != "" {
+			return cmdy.ErrWithCode(cmdy.ExitUsage, fmt.Errorf("-ball takes a single URL to compare"))
+		}
+		changed, err = cmd.diffLive(ctx)
+	} else {
+		if cmd.b == "" {
+			return cmdy.ErrWithCode(cmdy.ExitUsage, fmt.Errorf("expected two furballs, or a URL and -ball"))
+		}
+		changed, err = cmd.diffBalls(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if changed {
+		return cmdy.QuietExit(1)
+	}
+	return nil
+}
+
+func (cmd *diffCommand) diffLive(ctx cmdy.Context) (changed bool, err error) {
+	var uv urlVar
+	if err := uv.Set(cmd.a); err != nil {
+		return false, cmdy.ErrWithCode(cmdy.ExitUsage, err)
+	}
+	u := uv.URL()
+
+	entries, _, err := latestEntries(cmd.ballFile)
+	if err != nil {
+		return false, err
+	}
+	old := entries[entryKey(u)]
+	if old == nil {
+		return false, fmt.Errorf("no entry for %s in %q", u, cmd.ballFile)
+	}
+
+	live, err := cmd.fetchEntry(ctx, u)
+	if err != nil {
+		return false, err
+	}
+	return diffEntries(ctx.Stdout(), cmd.ballFile, old, "live", live, cmd.context)
+}
+
+// fetchEntry fetches u and returns the response as it would be recorded by -ball, so
+// it can be compared with recorded entries on equal terms.
+func (cmd *diffCommand) fetchEntry(ctx cmdy.Context, u gopher.URL) (*furball.Entry, error) {
+	var ball furball.Ball
+	cmd.recorder = &ball
+
+	client, done, err := cmd.Client(ctx)
+	defer done()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err = cmd.capsTLSPort(ctx, client, u)
+	if err != nil {
+		return nil, err
+	}
+	client = cmd.pins.Client(client, u)
+
+	// Errors are recorded with their status, so they are part of the comparison:
+	var gopherErr *gopher.Error
+	rs, err := client.Fetch(ctx, gopher.NewRequest(u, nil))
+	if err == nil {
+		_, err = io.Copy(ioutil.Discard, rs.Reader())
+		if cerr := rs.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil && !errors.As(err, &gopherErr) {
+		return nil, err
+	}
+
+	// The response is the last entry, after any failed TLS attempts or caps.txt:
+	if len(ball.Entries) == 0 {
+		return nil, fmt.Errorf("no response recorded for %s", u)
+	}
+	return &ball.Entries[len(ball.Entries)-1], nil
+}
+
+func (cmd *diffCommand) diffBalls(ctx cmdy.Context) (changed bool, err error) {
+	aEntries, aKeys, err := latestEntries(cmd.a)
+	if err != nil {
+		return false, err
+	}
+	bEntries, bKeys, err := latestEntries(cmd.b)
+	if err != nil {
+		return false, err
+	}
+
+	out := ctx.Stdout()
+	for _, key := range aKeys {
+		if bEntries[key] == nil {
+			fmt.Fprintf(out, "only in %s: %s\n", cmd.a, aEntries[key].URL)
+			changed = true
+			continue
+		}
+		c, err := diffEntries(out, cmd.a, aEntries[key], cmd.b, bEntries[key], cmd.context)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || c
+	}
+	for _, key := range bKeys {
+		if aEntries[key] == nil {
+			fmt.Fprintf(out, "only in %s: %s\n", cmd.b, bEntries[key].URL)
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// latestEntries returns the most recent entry for each URL in a furball, keyed by
+// entryKey, and the keys in the order they first appear.
+func latestEntries(path string) (entries map[string]*furball.Entry, keys []string, err error) {
+	entries = make(map[string]*furball.Entry)
+	err = eachEntry(path, func(n int, e *furball.Entry) bool {
+		key := entryKey(e.URL)
+		cur := entries[key]
+		if cur == nil {
+			keys = append(keys, key)
+		}
+		if cur == nil || !e.At.Before(cur.At) {
+			entries[key] = e
+		}
+		return true
+	})
+	return entries, keys, err
+}
+
+// entryKey identifies the request a URL makes, so responses to the same request can be
+// compared however the URL was written. The scheme and item type don't change what is
+// sent, and the host and port are normalised.
+func entryKey(u gopher.URL) string {
+	u = cache.Normalize(u)
+	return u.Host() + "\t" + u.Selector + "\t" + u.Search
+}
+
+// diffEntries writes the differences between two responses for the same URL to w.
+func diffEntries(w io.Writer, aName string, a *furball.Entry, bName string, b *furball.Entry, context int) (changed bool, err error) {
+	u := a.URL
+	if a.Status != b.Status {
+		fmt.Fprintf(w, "%s: status %s -> %s\n", u, entryStatus(a), entryStatus(b))
+		changed = true
+	}
+	if bytes.Equal(a.Out, b.Out) {
+		return changed, nil
+	}
+
+	kind := gopherdiff.KindOf(u, a.Out)
+	if kind != gopherdiff.KindOf(u, b.Out) {
+		kind = gopherdiff.Binary
+	}
+
+	if kind == gopherdiff.Menu {
+		changes, err := gopherdiff.Menus(a.Out, b.Out)
+		if err == nil {
+			if len(changes) == 0 {
+				return changed, nil
+			}
+			fmt.Fprintf(w, "%s: menu changed\n", u)
+			for _, c := range changes {
+				switch c.Op {
+				case gopherdiff.Delete:
+					fmt.Fprintf(w, "- %s\n", formatDiffDirent(c.Old))
+				case gopherdiff.Insert:
+					fmt.Fprintf(w, "+ %s\n", formatDiffDirent(c.New))
+				case gopherdiff.Changed:
+					fmt.Fprintf(w, "~ %s (was [%c] %s)\n", formatDiffDirent(c.New), c.Old.ItemType, c.Old.Display)
+				}
+			}
+			return true, nil
+		}
+
+		// Menus that can't be parsed can still be compared line by line:
+		kind = gopherdiff.Text
+	}
+
+	if kind == gopherdiff.Text {
+		lines := gopherdiff.Lines(gopherdiff.TextLines(a.Out), gopherdiff.TextLines(b.Out))
+		aLabel := fmt.Sprintf("%s: %s (%s)", aName, u, a.At.Local().Format("2006-01-02 15:04:05"))
+		bLabel := fmt.Sprintf("%s: %s (%s)", bName, u, b.At.Local().Format("2006-01-02 15:04:05"))
+		var buf bytes.Buffer
+		if err := gopherdiff.Unified(&buf, aLabel, bLabel, lines, context); err != nil {
+			return changed, err
+		}
+		if buf.Len() == 0 {
+			// Only the line endings or terminator differ:
+			return changed, nil
+		}
+		_, err := buf.WriteTo(w)
+		return true, err
+	}
+
+	_, err = fmt.Fprintf(w, "%s: binary response changed: %d bytes (sha256 %.12s) -> %d bytes (sha256 %.12s)\n",
+		u, len(a.Out), gopherdiff.Hash(a.Out), len(b.Out), gopherdiff.Hash(b.Out))
+	return true, err
+}
+
+func entryStatus(e *furball.Entry) string {
+	if e.Status == gopher.OK {
+		return "ok"
+	}
+	return fmt.Sprintf("%d (%s)", e.Status, e.Msg)
+}
+
+func formatDiffDirent(d *gopher.Dirent) string {
+	if d.ItemType == gopher.Info || d.ItemType == gopher.ItemError {
+		return fmt.Sprintf("[%c] %s", d.ItemType, d.Display)
+	}
+	return fmt.Sprintf("[%c] %s  %s  %s:%s", d.ItemType, d.Display, d.Selector, d.Hostname, d.Port)
+}
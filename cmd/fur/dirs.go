@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// The standard library provides os.UserCacheDir and os.UserConfigDir, but nothing for
+// the XDG state and data dirs, so these follow the XDG base directory spec directly.
+
+func userStateDir() (string, error) { return xdgDir("XDG_STATE_HOME", ".local", "state") }
+func userDataDir() (string, error)  { return xdgDir("XDG_DATA_HOME", ".local", "share") }
+
+func xdgDir(env string, dflt ...string) (string, error) {
+	if dir := os.Getenv(env); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append([]string{home}, dflt...)...), nil
+}
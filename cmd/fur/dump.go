@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+	"github.com/shabbyrobe/fur/internal/flatdump"
+	"github.com/shabbyrobe/fur/internal/furball"
+)
+
+const dumpUsage = `
+Write the entries in a furball as a stream of flatdump records, which are easier to
+produce and pick apart from the shell than JSON:
+
+    FUR-DUMP <time> <url> <length>
+    <response>
+
+Only the URL, time and response are kept. Use 'fur undump' to turn the stream back
+into a furball.
+`
+
+type dumpCommand struct {
+	file string
+	out  string
+}
+
+func newDumpCommand() cmdy.Command { return &dumpCommand{} }
+
+func (cmd *dumpCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Convert a furball to flatdump records",
+		Usage:    dumpUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Dump to stdout", Command: "ball.json"},
+			cmdy.Example{Desc: "Dump to a file", Command: "-o ball.dump ball.json"},
+		},
+	}
+}
+
+func (cmd *dumpCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	flags.StringVar(&cmd.out, "o", "", "Output file (default: stdout)")
+	args.String(&cmd.file, "ball", "Furball file")
+}
+
+func (cmd *dumpCommand) Run(ctx cmdy.Context) (rerr error) {
+	out, _, err := stdoutOrFileWriter(ctx.Stdout(), cmd.out, true)
+	if err != nil {
+		return err
+	}
+	defer DeferClose(&rerr, out)
+
+	bufw := bufio.NewWriter(out)
+	var werr error
+	if err := eachEntry(cmd.file, func(n int, e *furball.Entry) bool {
+		werr = flatdump.WriteFlatDump(bufw, e.URL, e.At, e.Out)
+		return werr == nil
+	}); err != nil {
+		return err
+	} else if werr != nil {
+		return werr
+	}
+	return bufw.Flush()
+}
+
+const undumpUsage = `
+Append flatdump records to a furball, creating it if it doesn't exist. Pass '-' to
+read the records from stdin. See 'fur dump' for the format.
+
+A record without a length runs to the end of the stream, so a single response dumped
+by hand can be undumped too.
+`
+
+type undumpCommand struct {
+	in   string
+	ball string
+}
+
+func newUndumpCommand() cmdy.Command { return &undumpCommand{} }
+
+func (cmd *undumpCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Convert flatdump records to a furball",
+		Usage:    undumpUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Undump a file", Command: "ball.dump ball.json"},
+			cmdy.Example{Desc: "Undump from stdin", Command: "- ball.jsonl"},
+		},
+	}
+}
+
+func (cmd *undumpCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	args.String(&cmd.in, "dump", "Flatdump file, or '-' for stdin")
+	args.String(&cmd.ball, "ball", "Furball file")
+}
+
+func (cmd *undumpCommand) Run(ctx cmdy.Context) error {
+	var in io.Reader = ctx.Stdin()
+	if cmd.in != "-" {
+		f, err := os.Open(cmd.in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var entries []furball.Entry
+	rdr := flatdump.NewReader(in)
+	for {
+		dump, err := rdr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(dump)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, furball.Entry{URL: dump.URL, At: dump.At, Out: data})
+	}
+
+	return furball.AppendBallFile(ctx, cmd.ball, entries)
+}
@@ -23,6 +23,9 @@ var (
 		gopher.StatusGeneralError: 65, // EX_DATAERR
 		gopher.StatusEmpty:        65, // EX_DATAERR
 	}
+
+	// Exit codes for problems found by fur itself, rather than reported by the server:
+	exitLintProblems = 65 // EX_DATAERR
 )
 
 func exitCode(status gopher.Status, dflt int) int {
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+)
+
+const goUsage = `
+Follow a link from the last directory that was rendered by fur, using the number
+printed next to the link. Accepts the same flags as fur itself.
+
+References:
+    <n>   The link numbered <n>
+    .     The last directory
+    ..    The parent of the last directory
+    -     The directory rendered before the last directory
+`
+
+type goCommand struct {
+	command
+	ref string
+}
+
+func newGoCommand() cmdy.Command { return &goCommand{} }
+
+func (cmd *goCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Follow a numbered link from the last directory",
+		Usage:    goUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Follow link 7", Command: "7"},
+			cmdy.Example{Desc: "Go up a level", Command: ".."},
+			cmdy.Example{Desc: "Search using link 3", Command: "3 term"},
+			cmdy.Example{Desc: "Follow link 2 as JSON, excluding 'i' types", Command: "-tx=i -j 2"},
+		},
+	}
+}
+
+func (cmd *goCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	cmd.command.configureFlags(flags)
+
+	args.String(&cmd.ref, "ref", "Link number, or one of '.', '..' or '-'")
+	args.StringOptional(&cmd.search, "search", "", "Search (overrides search portion of URL)")
+}
+
+func (cmd *goCommand) Run(ctx cmdy.Context) error {
+	bs, err := loadBrowseState()
+	if err != nil {
+		return err
+	}
+
+	ref := cmd.ref
+	if ref == ".." {
+		ref, cmd.up = ".", true
+	}
+
+	u, err := bs.Resolve(ref)
+	if err != nil {
+		return err
+	}
+
+	cmd.url = urlVar(u)
+	return cmd.command.Run(ctx)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const interactiveUsage = `
+  <n>        Follow link <n>
+  b          Back
+  f          Forward
+  u          Up to the parent menu
+  r          Reload
+  g <url>    Go to URL
+  h, ?       Show this help
+  q          Quit
+`
+
+// session holds the state for an interactive browsing session. A single gopher.Client
+// is kept alive for the duration of the session.
+type session struct {
+	cmd    *command
+	client *gopher.Client
+	in     *bufio.Scanner
+
+	// Everything that has been successfully visited, in order. pos is the index of the
+	// current page; anything after pos can be revisited with 'forward'.
+	history []gopher.URL
+	pos     int
+
+	// links from the most recently rendered directory. Documents don't replace these,
+	// so you can still follow links from the last directory after viewing one.
+	links []gopher.URL
+}
+
+func (cmd *command) runInteractive(ctx cmdy.Context) (rerr error) {
+	if cmd.json {
+		return fmt.Errorf("interactive mode does not support -j")
+	}
+
+	u, err := cmd.URL()
+	if err != nil {
+		return err
+	}
+
+	client, done, err := cmd.Client(ctx)
+	defer done()
+	if err != nil {
+		return err
+	}
+
+	if cmd.up {
+		if u, err = cmd.parentURL(ctx, client, u); err != nil {
+			return err
+		}
+	}
+
+	sess := &session{
+		cmd:    cmd,
+		client: client,
+		in:     bufio.NewScanner(ctx.Stdin()),
+		pos:    -1,
+	}
+
+	stderr := ctx.Stderr()
+	if err := sess.visit(ctx, u, true); err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+
+	for {
+		line, ok := sess.prompt(ctx, "fur> ")
+		if !ok {
+			break
+		}
+
+		if err := sess.exec(ctx, line); err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Fprintln(stderr, err)
+		}
+	}
+
+	return sess.in.Err()
+}
+
+func (sess *session) prompt(ctx cmdy.Context, msg string) (line string, ok bool) {
+	if cmdy.IsDone(ctx) {
+		return "", false
+	}
+	fmt.Fprint(ctx.Stderr(), msg)
+	if !sess.in.Scan() {
+		return "", false
+	}
+	return strings.TrimSpace(sess.in.Text()), true
+}
+
+// exec runs a single line of input. It returns io.EOF if the session should end.
+func (sess *session) exec(ctx cmdy.Context, line string) error {
+	if line == "" {
+		return nil
+	}
+
+	if n, err := strconv.Atoi(line); err == nil {
+		return sess.follow(ctx, n)
+	}
+
+	name, arg := line, ""
+	if idx := strings.IndexAny(line, " \t"); idx >= 0 {
+		name, arg = line[:idx], strings.TrimSpace(line[idx+1:])
+	}
+
+	switch name {
+	case "q", "quit", "exit":
+		return io.EOF
+
+	case "h", "help", "?":
+		fmt.Fprint(ctx.Stderr(), interactiveUsage)
+		return nil
+
+	case "b", "back":
+		if sess.pos <= 0 {
+			return fmt.Errorf("no previous page")
+		}
+		if err := sess.visit(ctx, sess.history[sess.pos-1], false); err != nil {
+			return err
+		}
+		sess.pos--
+		return nil
+
+	case "f", "forward":
+		if sess.pos+1 >= len(sess.history) {
+			return fmt.Errorf("no next page")
+		}
+		if err := sess.visit(ctx, sess.history[sess.pos+1], false); err != nil {
+			return err
+		}
+		sess.pos++
+		return nil
+
+	case "u", "up":
+		if sess.pos < 0 {
+			return fmt.Errorf("no current page")
+		}
+		u, err := sess.cmd.parentURL(ctx, sess.client, sess.history[sess.pos])
+		if err != nil {
+			return err
+		}
+		return sess.open(ctx, u)
+
+	case "r", "reload":
+		if sess.pos < 0 {
+			return fmt.Errorf("nothing to reload")
+		}
+		return sess.visit(ctx, sess.history[sess.pos], false)
+
+	case "g", "go":
+		if arg == "" {
+			return fmt.Errorf("missing URL")
+		}
+		var uv urlVar
+		if err := uv.Set(arg); err != nil {
+			return err
+		}
+		return sess.open(ctx, uv.URL())
+
+	default:
+		return fmt.Errorf("unknown command %q; type '?' for help", name)
+	}
+}
+
+func (sess *session) follow(ctx cmdy.Context, n int) error {
+	if n < 1 || n > len(sess.links) {
+		return fmt.Errorf("no link numbered %d", n)
+	}
+	return sess.open(ctx, sess.links[n-1])
+}
+
+// open visits a new URL, prompting for a search term if one is required.
+func (sess *session) open(ctx cmdy.Context, u gopher.URL) error {
+	if !u.CanFetch() {
+		return fmt.Errorf("cannot fetch URL %q", u)
+	}
+
+	if u.ItemType.IsSearch() && u.Search == "" {
+		search, ok := sess.prompt(ctx, "search: ")
+		if !ok || search == "" {
+			return nil
+		}
+		u.Search = search
+	}
+
+	return sess.visit(ctx, u, true)
+}
+
+// visit fetches and renders u. If push is true and the fetch succeeds, u is added to the
+// history after the current position, discarding anything that was ahead of it.
+func (sess *session) visit(ctx cmdy.Context, u gopher.URL, push bool) (rerr error) {
+	rs, err := sess.cmd.fetch(ctx, sess.client, u)
+	if err != nil {
+		return err
+	}
+	defer DeferClose(&rerr, rs)
+
+	rnd, allowDefaultStdout, err := sess.cmd.selectTextRenderer(rs)
+	if err != nil {
+		return err
+	}
+	sess.cmd.addCrumbs(ctx, sess.client, rnd, u)
+
+	var outFile string
+	if !allowDefaultStdout {
+		outFile = autoFileName(u)
+		if outFile == "" {
+			return fmt.Errorf("could not infer file name for %q", u)
+		}
+	}
+
+	out, isFile, err := stdoutOrFileWriter(ctx.Stdout(), outFile, allowDefaultStdout)
+	if err != nil {
+		return err
+	}
+	defer DeferClose(&rerr, out)
+
+	if isFile {
+		fmt.Fprintf(ctx.Stderr(), "writing to %q\n", outFile)
+	}
+
+	if err := rnd.Render(out, rs); err != nil {
+		return err
+	}
+
+	if drnd, ok := rnd.(*dirRenderer); ok {
+		sess.links = drnd.links
+		sess.cmd.saveBrowseState(ctx, u, drnd.links)
+	}
+
+	if push {
+		sess.history = append(sess.history[:sess.pos+1], u)
+		sess.pos++
+	}
+
+	return nil
+}
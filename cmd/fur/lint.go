@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+	"github.com/shabbyrobe/fur/internal/menulint"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const lintUsage = `
+Fetch a directory and report protocol problems, one line at a time. Exits with
+status 65 if any problems are found, so it can be used to check a gopherhole in CI.
+
+Problems:
+    fields       Wrong number of tab-separated fields, or an empty line
+    port         Missing or non-numeric port
+    crlf         Line not terminated with CRLF
+    terminator   Missing '.' terminator, or data after it
+    itemtype     Unknown item type
+    dummyhost    Dummy host in an 'i' or '3' line that isn't '.invalid'
+    control      Control characters in the display string
+`
+
+type lintCommand struct {
+	command
+	target    string
+	gophermap bool
+}
+
+func newLintCommand() cmdy.Command { return &lintCommand{} }
+
+func (cmd *lintCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Check a menu for protocol problems",
+		Usage:    lintUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Lint floodgap's root menu", Command: "gopher://gopher.floodgap.com/"},
+			cmdy.Example{Desc: "Lint as JSON lines", Command: "-j gopher://gopher.floodgap.com/1/world"},
+			cmdy.Example{Desc: "Lint a local gophermap file", Command: "-map ./gophermap"},
+		},
+	}
+}
+
+func (cmd *lintCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	cmd.command.configureClientFlags(flags)
+
+	flags.BoolVar(&cmd.json, "j", false, "Print problems as JSON lines")
+	flags.BoolVar(&cmd.gophermap, "map", false, ""+
+		"Lint a local gophermap file instead of fetching a URL. CRLF, the '.' terminator, hosts and ports are not required, and lines without a tab are info lines.")
+
+	args.String(&cmd.target, "url", "Gopher URL of a directory, or a file if -map is passed")
+}
+
+func (cmd *lintCommand) Run(ctx cmdy.Context) error {
+	var data []byte
+	var flags menulint.Flags
+	var err error
+
+	if cmd.gophermap {
+		flags |= menulint.Gophermap
+		data, err = ioutil.ReadFile(cmd.target)
+	} else {
+		data, err = cmd.fetchMenu(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	problems := menulint.Lint(data, flags)
+	if cmd.json {
+		enc := json.NewEncoder(ctx.Stdout())
+		for _, p := range problems {
+			if err := enc.Encode(p); err != nil {
+				return err
+			}
+		}
+	} else {
+		printLintProblems(ctx.Stdout(), problems)
+	}
+
+	if len(problems) > 0 {
+		return cmdy.ErrWithCode(exitLintProblems, fmt.Errorf("%d problem(s) found in %s", len(problems), cmd.target))
+	}
+	return nil
+}
+
+// fetchMenu fetches the raw bytes of the directory, without decoding or error
+// interception, so the linter sees exactly what the server sent.
+func (cmd *lintCommand) fetchMenu(ctx cmdy.Context) (data []byte, rerr error) {
+	var uv urlVar
+	if err := uv.Set(cmd.target); err != nil {
+		return nil, cmdy.ErrWithCode(cmdy.ExitUsage, err)
+	}
+	u := uv.URL()
+	if !u.Root && u.ItemType != gopher.Dir && u.ItemType != gopher.Search {
+		return nil, cmdy.ErrWithCode(cmdy.ExitUsage, fmt.Errorf("%s is not a directory", u))
+	}
+
+	client, done, err := cmd.Client(ctx)
+	defer done()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err = cmd.capsTLSPort(ctx, client, u)
+	if err != nil {
+		return nil, err
+	}
+	client = cmd.pins.Client(client, u)
+
+	rs, err := client.Raw(ctx, gopher.NewRequest(u, nil))
+	if err != nil {
+		return nil, err
+	}
+	defer DeferClose(&rerr, rs)
+
+	return ioutil.ReadAll(rs.Reader())
+}
+
+func printLintProblems(out io.Writer, problems []menulint.Problem) {
+	last := -1
+	for _, p := range problems {
+		if p.Line != last {
+			if p.Raw != "" {
+				fmt.Fprintf(out, "line %d: %q\n", p.Line, strings.TrimRight(p.Raw, "\r\n"))
+			} else {
+				fmt.Fprintf(out, "line %d:\n", p.Line)
+			}
+			last = p.Line
+		}
+		fmt.Fprintf(out, "    %-10s %s\n", p.Code, p.Msg)
+	}
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/shabbyrobe/cmdy"
 	"github.com/shabbyrobe/cmdy/cmdyutil"
@@ -20,6 +23,59 @@ func run() error {
 	pt := profiletools.EnvProfile("FUR_")
 	defer pt.Stop()
 
-	bld := func() cmdy.Command { return &command{} }
-	return cmdyutil.InterruptibleRun(context.Background(), os.Args[1:], bld)
+	args := os.Args[1:]
+	return cmdyutil.InterruptibleRun(context.Background(), args, rootBuilder(args))
+}
+
+func subcommands() cmdy.Builders {
+	return cmdy.Builders{
+		"ball":   newBallGroup,
+		"bm":     newBookmarkGroup,
+		"cache":  newCacheGroup,
+		"check":  newCheckCommand,
+		"caps":   newCapsCommand,
+		"crawl":  newCrawlCommand,
+		"diff":   newDiffCommand,
+		"dump":   newDumpCommand,
+		"go":     newGoCommand,
+		"lint":   newLintCommand,
+		"mirror": newMirrorCommand,
+		"replay": newReplayCommand,
+		"tofu":   newTofuGroup,
+		"undump": newUndumpCommand,
+	}
+}
+
+// rootBuilder selects the subcommand group if the first argument names a subcommand,
+// otherwise it selects the default command, which fetches and renders a URL. The group
+// can't make this choice itself as it would fail to parse the default command's flags.
+func rootBuilder(args []string) cmdy.Builder {
+	if len(args) > 0 {
+		if _, ok := subcommands()[args[0]]; ok {
+			return newRootGroup
+		}
+	}
+	return newCommand
+}
+
+func newRootGroup() cmdy.Command {
+	return cmdy.NewGroup("Fur - CLI Gopher Client", subcommands())
+}
+
+// subcommandUsage lists the subcommands so they can be discovered from the default
+// command's help.
+func subcommandUsage() string {
+	bldrs := subcommands()
+	names := make([]string, 0, len(bldrs))
+	for name := range bldrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out strings.Builder
+	out.WriteString("\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(&out, "    %-8s  %s\n", name, bldrs[name]().Help().Synopsis)
+	}
+	return out.String()
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+	"github.com/shabbyrobe/fur/internal/crawl"
+	"github.com/shabbyrobe/fur/internal/mirror"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const mirrorUsage = `
+Download a menu and everything below it on the same server into a directory, which
+can then be served by Bucktooth, or any server that understands its gophermap files
+(see doc/gophermap.txt).
+
+Each menu is saved as a file called 'gophermap' in the directory for its selector, and
+everything else is saved as a file named after its selector. Links to anything that
+was mirrored are rewritten to point into the mirror; everything else still points at
+the original server. The start URL becomes the root of the mirror, so links to
+anything above it on the server are left alone.
+
+Gopher has no way to ask whether something has changed, so running the command again
+fetches every menu again, but only fetches documents that aren't in the mirror yet.
+Pass -all to fetch them all again. Nothing is ever removed from the mirror.
+
+Like 'fur crawl', robots.txt is honoured unless -norobots is passed.
+`
+
+type mirrorCommand struct {
+	command
+	robotsFlags
+	dir     string
+	depth   int
+	workers int
+	delay   time.Duration
+	limit   int
+	all     bool
+}
+
+func newMirrorCommand() cmdy.Command { return &mirrorCommand{} }
+
+func (cmd *mirrorCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Mirror a gopherhole to a directory",
+		Usage:    mirrorUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Mirror part of a gopherhole", Command: "gopher://localhost/1/phlog ./phlog"},
+			cmdy.Example{Desc: "Mirror without images", Command: "-tx=Ig gopher://localhost/ ./out"},
+		},
+	}
+}
+
+func (cmd *mirrorCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	cmd.command.configureClientFlags(flags)
+	cmd.configureRobotsFlags(flags)
+
+	flags.IntVar(&cmd.depth, "depth", 20, "Follow links this many menus deep")
+	flags.IntVar(&cmd.workers, "workers", 4, "Number of URLs to fetch at once")
+	flags.DurationVar(&cmd.delay, "delay", 1*time.Second, "Minimum time between requests")
+	flags.IntVar(&cmd.limit, "limit", 0, "Stop after fetching this many URLs (0 = unlimited)")
+	flags.BoolVar(&cmd.all, "all", false, "Fetch documents that are already in the mirror again")
+	flags.Var(&cmd.include, "ti", "Mirror these item types. Pass as a string, no spaces or commas. Can pass multiple times.")
+	flags.Var(&cmd.exclude, "tx", "Don't mirror these item types. Takes precedence over -ti.")
+
+	args.Var(&cmd.url, "url", "Gopher URL of the menu to mirror")
+	args.String(&cmd.dir, "dir", "Directory to mirror into")
+}
+
+func (cmd *mirrorCommand) Run(ctx cmdy.Context) error {
+	start := cmd.url.URL()
+	if !crawl.IsMenu(start) {
+		return cmdy.ErrWithCode(cmdy.ExitUsage, fmt.Errorf("%s is not a menu", start))
+	}
+	mr, err := mirror.New(start, cmd.dir)
+	if err != nil {
+		return cmdy.ErrWithCode(cmdy.ExitUsage, err)
+	}
+	types := cmd.itemSet()
+
+	client, done, err := cmd.Client(ctx)
+	defer done()
+	if err != nil {
+		return err
+	}
+
+	crawler := &crawl.Crawler{
+		Client:    client,
+		ClientFor: cmd.pins.Client,
+		Workers:   cmd.workers,
+		MaxDepth:  cmd.depth,
+		Limit:     cmd.limit,
+		Delay:     cmd.delay,
+		Robots:    cmd.robotsSource(client, cmd.pins),
+		Follow: func(u gopher.URL, parent *crawl.Item) bool {
+			if _, ok := mr.Selector(u); !ok || !types[u.ItemType] {
+				return false
+			}
+			return crawl.IsMenu(u) || cmd.all || !mr.Exists(u)
+		},
+	}
+
+	log := newCrawlLog(ctx.Stdout())
+	var written int
+	crawler.Visit = func(rs *crawl.Result) error {
+		if !log.visit(rs) || rs.Err != nil || rs.Entry.Status != gopher.OK {
+			return nil
+		}
+		if crawl.IsMenu(rs.URL) {
+			return mr.AddMenu(rs.URL, rs.Entry.Out)
+		}
+		// A document that can't be stored, such as one whose name clashes with a
+		// directory made for another selector, shouldn't stop the rest of the mirror:
+		if err := mr.WriteDocument(rs.URL, rs.Entry.Out); err != nil {
+			log.fail(err)
+			return nil
+		}
+		written++
+		return nil
+	}
+
+	err = crawler.Crawl(ctx, start)
+
+	// Even if the crawl was interrupted, the menus that were fetched should be written
+	// so the documents that were written can be found:
+	changed, merr := mr.WriteMenus()
+	log.summary(ctx.Stderr())
+	fmt.Fprintf(ctx.Stderr(), "wrote %d documents, %d menus changed\n", written, len(changed))
+	if err != nil {
+		return err
+	}
+	return merr
+}
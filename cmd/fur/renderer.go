@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/bbrks/wrap"
+	"github.com/shabbyrobe/fur/internal/caps"
 	"github.com/shabbyrobe/furlib/gopher"
 )
 
@@ -56,6 +57,21 @@ type dirRenderer struct {
 	icons    *[256]rune
 	cols     int
 	maxEmpty int
+
+	// If numbered is set, each link is prefixed with its index in links, starting at 1.
+	numbered bool
+
+	// If crumbs is set, the crumb names are printed as a header above the menu.
+	crumbs []caps.Crumb
+
+	// If showLink is set, links it returns false for are not printed. It is passed
+	// each link's index in links, so hidden links still take up a number.
+	showLink func(idx int) bool
+
+	// links collects the URL of every dirent that isn't an 'i' line, in order, including
+	// any that were skipped by the item filter. This means link numbers don't shift
+	// around when the filter changes.
+	links []gopher.URL
 }
 
 var _ renderer = &dirRenderer{}
@@ -79,7 +95,22 @@ func (d *dirRenderer) Render(out io.Writer, rs gopher.Response) error {
 
 	var lset byteSet
 
+	if len(d.crumbs) > 0 {
+		names := make([]string, len(d.crumbs))
+		for i, c := range d.crumbs {
+			names[i] = c.Name
+		}
+		fmt.Fprintf(out, "\033[38;5;45m%s\033[m\n\n", strings.Join(names, " \033[38;5;241m›\033[38;5;45m "))
+	}
+
 	for drs.Next(&dirent) {
+		if dirent.ItemType != gopher.Info {
+			d.links = append(d.links, dirent.URL())
+			if d.showLink != nil && !d.showLink(len(d.links)-1) {
+				continue
+			}
+		}
+
 		if !d.items[dirent.ItemType] {
 			continue
 		}
@@ -115,6 +146,10 @@ func (d *dirRenderer) Render(out io.Writer, rs gopher.Response) error {
 			}
 
 		default:
+			if d.numbered {
+				fmt.Fprintf(out, "\033[38;5;208m%d\033[m ", len(d.links))
+			}
+
 			var c rune = icons[dirent.ItemType]
 			if c == 0 {
 				fmt.Fprintf(out, "%s%c\033[m) ", itemColors[dirent.ItemType], dirent.ItemType)
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const replayUsage = `
+Render responses recorded in a furball (see 'fur -ball') without touching the
+network. Responses go through the same renderers as they would have when they
+were fetched, so rendering bugs can be reproduced from someone else's recording.
+
+If <entry> is a number, only that entry is rendered (starting at 1). Otherwise,
+every entry whose URL contains <entry> is rendered, in the order they were
+recorded. If <entry> is omitted, every entry is rendered.
+`
+
+type replayCommand struct {
+	command
+	file  string
+	entry string
+}
+
+func newReplayCommand() cmdy.Command { return &replayCommand{} }
+
+func (cmd *replayCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Render responses recorded in a furball",
+		Usage:    replayUsage,
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Replay everything", Command: "ball.json"},
+			cmdy.Example{Desc: "Replay the third entry as JSON", Command: "-j ball.json 3"},
+			cmdy.Example{Desc: "Replay entries for floodgap, excluding 'i' types", Command: "-tx=i ball.json floodgap.com"},
+		},
+	}
+}
+
+func (cmd *replayCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	cmd.command.configureRenderFlags(flags)
+
+	args.String(&cmd.file, "ball", "Furball file")
+	args.StringOptional(&cmd.entry, "entry", "", "Entry number, or a string to match against entry URLs")
+}
+
+// entries returns the entries in ball selected by cmd.entry, along with their numbers.
+func (cmd *replayCommand) entries(ball *furball.Ball) (entries []furball.Entry, nums []int, err error) {
+	if n, err := strconv.Atoi(cmd.entry); err == nil {
+		if n < 1 || n > len(ball.Entries) {
+			return nil, nil, fmt.Errorf("no entry numbered %d in %q; found %d entries", n, cmd.file, len(ball.Entries))
+		}
+		return ball.Entries[n-1 : n], []int{n}, nil
+	}
+
+	for i, e := range ball.Entries {
+		if strings.Contains(e.URL.String(), cmd.entry) {
+			entries = append(entries, e)
+			nums = append(nums, i+1)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("no entries in %q match %q", cmd.file, cmd.entry)
+	}
+	return entries, nums, nil
+}
+
+func (cmd *replayCommand) Run(ctx cmdy.Context) error {
+	if cmd.raw && cmd.txt {
+		return fmt.Errorf("-raw and -txt are mutually exclusive")
+	}
+
+	ball, err := furball.LoadBallFile(cmd.file)
+	if err != nil {
+		return err
+	}
+
+	entries, nums, err := cmd.entries(ball)
+	if err != nil {
+		return err
+	}
+
+	// A single entry fails like 'fur' would have when it was recorded. When replaying
+	// several, each failure is reported and the rest are still rendered:
+	if len(entries) == 1 {
+		return cmd.replay(ctx, &entries[0])
+	}
+
+	var failed int
+	stderr := ctx.Stderr()
+	for i := range entries {
+		e := &entries[i]
+		fmt.Fprintf(stderr, "  -- entry %d: %s, %s, took %s --  \n", nums[i], e.URL, e.At.Format("2006-01-02 15:04:05"), e.Taken)
+		if err := cmd.replay(ctx, e); err != nil {
+			fmt.Fprintln(stderr, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d entries failed", failed, len(entries))
+	}
+	return nil
+}
+
+func (cmd *replayCommand) replay(ctx cmdy.Context, e *furball.Entry) (rerr error) {
+	u := e.URL
+
+	// Only the status was recorded for errors detected by the client, so we can't tell
+	// how confident it was:
+	if e.Status != gopher.OK {
+		return cmdy.ErrWithCode(exitCode(e.Status, 2), gopher.NewError(u, e.Status, e.Msg, 1))
+	}
+
+	if cmd.raw || cmd.txt {
+		var rdr io.Reader = bytes.NewReader(e.Out)
+		if cmd.txt {
+			rdr = gopher.NewTextReader(rdr)
+		}
+		if cmd.lcut > 0 {
+			return copyWithLcut(ctx.Stdout(), rdr, cmd.lcut)
+		}
+		_, err := io.Copy(ctx.Stdout(), rdr)
+		return err
+	}
+
+	rs := newResponse(gopher.NewRequest(u, nil), e.Out)
+	defer DeferClose(&rerr, rs)
+
+	rnd, allowDefaultStdout, err := cmd.selectRenderer(rs)
+	if err != nil {
+		return err
+	}
+	cmd.addCrumbs(ctx, nil, rnd, u)
+
+	outFile := cmd.outFileName(u)
+	out, isFile, err := stdoutOrFileWriter(ctx.Stdout(), outFile, allowDefaultStdout)
+	if err != nil {
+		return err
+	}
+	defer DeferClose(&rerr, out)
+
+	if isFile {
+		fmt.Fprintf(ctx.Stderr(), "writing to %q\n", outFile)
+	}
+
+	return rnd.Render(out, rs)
+}
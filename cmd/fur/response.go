@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// newResponse wraps the raw bytes of a response that has already been read off the wire
+// (or out of a file) in the same type of gopher.Response that gopher.Client.Fetch would
+// have returned for the request, so it can be passed to a renderer.
+func newResponse(rq *gopher.Request, data []byte) gopher.Response {
+	info := &gopher.ResponseInfo{Request: rq}
+	rdr := ioutil.NopCloser(bytes.NewReader(data))
+
+	u := rq.URL()
+	it := u.ItemType
+	if u.Root {
+		it = gopher.Dir
+	}
+
+	if it.IsBinary() {
+		return gopher.NewBinaryResponse(info, rdr)
+	}
+	switch it {
+	case gopher.UUEncoded:
+		return gopher.NewUUEncodedResponse(info, rdr)
+	case gopher.Dir, gopher.Search:
+		return gopher.NewDirResponse(info, rdr)
+	}
+	return gopher.NewTextResponse(info, rdr)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/fur/internal/robots"
+	"github.com/shabbyrobe/fur/internal/tofu"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// robotsFlags is embedded in commands that fetch whole gopherholes, which honour the
+// server's robots.txt unless -norobots is passed.
+type robotsFlags struct {
+	noRobots bool
+}
+
+func (rf *robotsFlags) configureRobotsFlags(flags *cmdy.FlagSet) {
+	flags.BoolVar(&rf.noRobots, "norobots", false, "Ignore robots.txt. Only use this on your own servers.")
+}
+
+// robotsSource creates a robots.Source that fetches robots.txt files using a copy of
+// client that doesn't record to the furball, or returns nil if -norobots was passed.
+// Certificates are checked against pins, like they are for the pages themselves.
+func (rf *robotsFlags) robotsSource(client *gopher.Client, pins *tofu.Store) *robots.Source {
+	if rf.noRobots {
+		return nil
+	}
+	robotsClient := *client
+	robotsClient.Recorder = nil
+	src := robots.NewSource(&robotsClient)
+	src.ClientFor = pins.Client
+	return src
+}
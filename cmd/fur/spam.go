@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/fur/internal/bench"
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/fur/internal/linkcheck"
+	"github.com/shabbyrobe/fur/internal/timing"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+func (cmd *command) spamming() bool {
+	return cmd.spam > 0 || cmd.duration > 0 || cmd.workload != "" || cmd.replay != ""
+}
+
+// spamWorkload returns what to spam: the URL, the URLs in the -workload file, or the
+// requests in the -replay furball.
+func (cmd *command) spamWorkload() (*bench.Workload, error) {
+	if cmd.workload != "" || cmd.replay != "" {
+		if cmd.workload != "" && cmd.replay != "" {
+			return nil, cmdy.ErrWithCode(cmdy.ExitUsage, fmt.Errorf("-workload and -replay are mutually exclusive"))
+		} else if !cmd.url.URL().IsEmpty() {
+			return nil, cmdy.ErrWithCode(cmdy.ExitUsage, fmt.Errorf("<url> can't be used with -workload or -replay"))
+		}
+	}
+
+	var wl *bench.Workload
+	var err error
+	switch {
+	case cmd.replay != "":
+		if cmd.rps > 0 || cmd.ramp > 0 {
+			return nil, cmdy.ErrWithCode(cmdy.ExitUsage, fmt.Errorf("-rps and -ramp can't be used with -replay, which keeps the recorded timing"))
+		}
+		ball, err := furball.LoadBallFile(cmd.replay)
+		if err != nil {
+			return nil, err
+		}
+		if wl, err = bench.ReplayBall(ball); err != nil {
+			return nil, err
+		}
+
+	case cmd.workload != "":
+		if cmd.spam <= 0 && cmd.duration <= 0 {
+			return nil, cmdy.ErrWithCode(cmdy.ExitUsage, fmt.Errorf("-workload needs -spam or -duration to say when to stop"))
+		}
+		if wl, err = bench.LoadWorkloadFile(cmd.workload); err != nil {
+			return nil, err
+		}
+
+	default:
+		u, err := cmd.URL()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := cmd.request(u); err != nil {
+			return nil, err
+		}
+		if wl, err = bench.NewWorkload([]bench.Target{{URL: u, Weight: 1, Format: cmd.format}}); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range wl.Targets {
+		if _, err := wl.Targets[i].Request(); err != nil {
+			return nil, fmt.Errorf("can't spam %q: %w", wl.Targets[i].URL, err)
+		}
+	}
+	return wl, nil
+}
+
+// spamTicket is a request for a worker to send. due is when it was due, or zero if it's
+// due as soon as a worker is free to send it.
+type spamTicket struct {
+	due    time.Time
+	target int
+}
+
+// runSpam load tests the URL, then reports how long it all took, like 'ab' or 'hey'.
+//
+// Without -rps, the test is closed-loop: each worker sends its next request as soon as
+// the last one finishes. With -rps, it's open-loop: requests are sent when they're due,
+// as long as there's a worker free to send them, and latency is measured from when
+// they were due, so a server that slows down can't slow the test down with it and hide
+// how slow it is (coordinated omission).
+func (cmd *command) runSpam(ctx cmdy.Context) (rerr error) {
+	if cmd.spamWorkers <= 0 {
+		return fmt.Errorf("spam workers must be > 0")
+	}
+	if cmd.rps < 0 {
+		return fmt.Errorf("-rps must be >= 0")
+	}
+
+	wl, err := cmd.spamWorkload()
+	if err != nil {
+		return err
+	}
+
+	client, done, err := cmd.Client(ctx)
+	defer done()
+	if err != nil {
+		return err
+	}
+
+	if client.TLSClientConfig == nil {
+		client.TLSClientConfig = &tls.Config{}
+	}
+	client.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1000)
+
+	// Certificates are pinned per host, so each host needs a client of its own:
+	clients := make([]*gopher.Client, len(wl.Targets))
+	hostClients := make(map[string]*gopher.Client)
+	for i, target := range wl.Targets {
+		key := target.URL.Host()
+		if target.URL.IsSecure() {
+			key = "s:" + key
+		}
+		if hostClients[key] == nil {
+			hostClients[key] = cmd.pins.Client(client, target.URL)
+		}
+		clients[i] = hostClients[key]
+	}
+
+	stderr := ctx.Stderr()
+	var what string
+	switch {
+	case cmd.spam > 0 && cmd.duration > 0:
+		what = fmt.Sprintf("%d requests for up to %s", cmd.spam, cmd.duration)
+	case cmd.spam > 0:
+		what = fmt.Sprintf("%d requests", cmd.spam)
+	case cmd.duration > 0:
+		what = fmt.Sprintf("for %s", cmd.duration)
+	default:
+		what = fmt.Sprintf("%d requests", len(wl.Targets))
+	}
+	if wl.Replay {
+		fmt.Fprintf(stderr, "spamming %s replayed from %q with up to %d workers\n", what, cmd.replay, cmd.spamWorkers)
+	} else if cmd.rps > 0 {
+		fmt.Fprintf(stderr, "spamming %s at %g requests/sec with up to %d workers\n", what, cmd.rps, cmd.spamWorkers)
+	} else {
+		fmt.Fprintf(stderr, "spamming %s with %d workers\n", what, cmd.spamWorkers)
+	}
+	if cmd.workload != "" {
+		fmt.Fprintf(stderr, "%d URLs from %q\n", len(wl.Targets), cmd.workload)
+	} else if !wl.Replay {
+		fmt.Fprintf(stderr, "%q\n", wl.Targets[0].URL)
+	}
+
+	begin := time.Now()
+	stats := bench.NewStats(begin)
+
+	// stop is closed when no more requests should be sent, because time is up or we
+	// were interrupted. Requests that have already been sent are allowed to finish
+	// unless we were interrupted.
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	stopNow := func() { stopOnce.Do(func() { close(stop) }) }
+	if cmd.duration > 0 {
+		tm := time.AfterFunc(cmd.duration, stopNow)
+		defer tm.Stop()
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			stopNow()
+		case <-stop:
+		}
+	}()
+
+	tickets := make(chan spamTicket, cmd.spamWorkers)
+	missedTickets := make(chan int64, 1)
+	go func() {
+		missedTickets <- cmd.spamTickets(begin, wl, tickets, stop)
+	}()
+
+	var missed int64
+	var wg sync.WaitGroup
+	for i := 0; i < cmd.spamWorkers; i++ {
+		// Without -rps, -ramp starts the workers gradually instead:
+		var delay time.Duration
+		if cmd.rps == 0 && !wl.Replay {
+			delay = time.Duration(int64(cmd.ramp) * int64(i) / int64(cmd.spamWorkers))
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if delay > 0 {
+				tm := time.NewTimer(delay)
+				defer tm.Stop()
+				select {
+				case <-tm.C:
+				case <-stop:
+					return
+				}
+			}
+
+			for tk := range tickets {
+				select {
+				case <-stop:
+					if !tk.due.IsZero() {
+						atomic.AddInt64(&missed, 1)
+					}
+					continue
+				default:
+				}
+
+				start := tk.due
+				if start.IsZero() {
+					start = time.Now()
+				}
+				target := &wl.Targets[tk.target]
+				rq, _ := target.Request()
+				sm := spamOnce(ctx, clients[tk.target], rq, start)
+				sm.URL = target.URL.String()
+
+				// Requests cut off by an interrupt didn't fail, so they aren't counted:
+				if ctx.Err() != nil {
+					continue
+				}
+				stats.Add(sm)
+			}
+		}()
+	}
+
+	workersDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(workersDone)
+	}()
+
+	var tick <-chan time.Time
+	if cmd.progress > 0 {
+		ticker := time.NewTicker(cmd.progress)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+wait:
+	for {
+		select {
+		case <-tick:
+			fmt.Fprintln(stderr, stats.Report(time.Now()).Progress())
+		case <-workersDone:
+			break wait
+		}
+	}
+
+	rp := stats.Report(time.Now())
+	rp.TargetRPS = cmd.rps
+	rp.Missed = missed + <-missedTickets
+	if cmd.json {
+		enc := json.NewEncoder(ctx.Stdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(rp)
+	}
+	return rp.WriteText(ctx.Stdout())
+}
+
+// spamTickets sends a ticket for each request to tickets, until there have been -spam
+// of them, the replay is over, or stop is closed, then closes tickets. With -rps or a
+// replay, each ticket is sent when it's due; otherwise tickets are sent as soon as a
+// worker is free to take one. Returns the number of requests that were due but couldn't
+// be handed to a worker before stop was closed.
+func (cmd *command) spamTickets(begin time.Time, wl *bench.Workload, tickets chan<- spamTicket, stop <-chan struct{}) (missed int64) {
+	defer close(tickets)
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	sched := bench.Schedule{Rate: cmd.rps, Ramp: cmd.ramp}
+	for i := int64(0); cmd.spam <= 0 || i < int64(cmd.spam); i++ {
+		var tk spamTicket
+		if wl.Replay {
+			if i >= int64(len(wl.Targets)) {
+				break
+			}
+			tk.target = int(i)
+			tk.due = begin.Add(wl.Targets[i].At)
+		} else {
+			tk.target = wl.Pick(rnd)
+			if cmd.rps > 0 {
+				tk.due = begin.Add(sched.At(i))
+			}
+		}
+
+		if due := tk.due; !due.IsZero() {
+			if wait := time.Until(due); wait > 0 {
+				tm := time.NewTimer(wait)
+				select {
+				case <-tm.C:
+				case <-stop:
+					tm.Stop()
+					return missed
+				}
+			}
+		}
+
+		select {
+		case tickets <- tk:
+		case <-stop:
+			if !tk.due.IsZero() {
+				missed++
+			}
+			return missed
+		}
+	}
+	return missed
+}
+
+// spamOnce fetches rq, discarding the response, and times it from start.
+func spamOnce(ctx context.Context, client *gopher.Client, rq *gopher.Request, start time.Time) (sm bench.Sample) {
+	tr := &timing.Trace{}
+	rs, err := client.Fetch(timing.WithTrace(ctx, tr), rq)
+	tr.Received()
+	if err == nil {
+		var n int64
+		n, err = readTimed(rs.Reader(), func() { sm.TTFB = time.Since(start) })
+		sm.Bytes = n
+		if cerr := rs.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	sm.Total = time.Since(start)
+	if sm.TTFB == 0 {
+		sm.TTFB = sm.Total
+	}
+	if phases, ok := tr.Timing(); ok {
+		sm.Timing = &phases
+	}
+
+	if err != nil {
+		var gopherErr *gopher.Error
+		if errors.As(err, &gopherErr) {
+			sm.Status = gopherErr.Status
+		} else {
+			sm.Err, _ = linkcheck.Classify(err)
+		}
+	}
+	return sm
+}
+
+// readTimed reads rdr until EOF, calling first when the first byte arrives, or when
+// the response turns out to be empty.
+func readTimed(rdr io.Reader, first func()) (n int64, err error) {
+	var buf [32 * 1024]byte
+	for {
+		rn, rerr := rdr.Read(buf[:])
+		if first != nil && (rn > 0 || rerr != nil) {
+			first()
+			first = nil
+		}
+		n += int64(rn)
+		if rerr == io.EOF {
+			return n, nil
+		} else if rerr != nil {
+			return n, rerr
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const browseStateFile = "last.json"
+
+// browseState remembers the last directory that was rendered so that 'fur go' can
+// resolve link numbers against it in a later invocation.
+type browseState struct {
+	URL   gopher.URL   `json:"url"`
+	Prev  *gopher.URL  `json:"prev,omitempty"`
+	Links []gopher.URL `json:"links"`
+}
+
+// Resolve a reference passed to 'fur go' against the state:
+//
+//	<n>   the link numbered <n> in the last directory
+//	.     the last directory
+//	-     the directory rendered before the last one
+//
+// '..' isn't resolved here, as finding the parent may require the server's caps; 'fur go'
+// resolves '.' and passes -up instead.
+func (bs *browseState) Resolve(ref string) (gopher.URL, error) {
+	if bs.URL.IsEmpty() {
+		return gopher.URL{}, fmt.Errorf("no directory has been visited yet")
+	}
+
+	switch ref {
+	case ".":
+		return bs.URL, nil
+
+	case "-":
+		if bs.Prev == nil {
+			return gopher.URL{}, fmt.Errorf("no previous directory")
+		}
+		return *bs.Prev, nil
+	}
+
+	n, err := strconv.Atoi(ref)
+	if err != nil {
+		return gopher.URL{}, fmt.Errorf("invalid link reference %q; expected a number, '.', '..' or '-'", ref)
+	}
+	if n < 1 || n > len(bs.Links) {
+		return gopher.URL{}, fmt.Errorf("no link numbered %d in %s", n, bs.URL)
+	}
+	return bs.Links[n-1], nil
+}
+
+func browseStatePath() (string, error) {
+	dir, err := userStateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "fur", browseStateFile), nil
+}
+
+func loadBrowseState() (*browseState, error) {
+	file, err := browseStatePath()
+	if err != nil {
+		return nil, err
+	}
+
+	var bs browseState
+	data, err := ioutil.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return &bs, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &bs); err != nil {
+		return nil, fmt.Errorf("fur: could not load state %q: %w", file, err)
+	}
+	return &bs, nil
+}
+
+func saveBrowseState(bs *browseState) error {
+	file, err := browseStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(bs)
+	if err != nil {
+		return err
+	}
+
+	var b [8]byte
+	rand.Read(b[:])
+	tmpFile := file + "." + hex.EncodeToString(b[:])
+	if err := ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
+
+// saveBrowseState records u as the last rendered directory. Failing to save the state
+// shouldn't fail the command, so errors are only reported to stderr.
+func (cmd *command) saveBrowseState(ctx cmdy.Context, u gopher.URL, links []gopher.URL) {
+	bs, err := loadBrowseState()
+	if err != nil {
+		bs = &browseState{}
+	}
+
+	if !bs.URL.IsEmpty() && bs.URL != u {
+		prev := bs.URL
+		bs.Prev = &prev
+	}
+	bs.URL = u
+	bs.Links = links
+
+	if err := saveBrowseState(bs); err != nil {
+		fmt.Fprintf(ctx.Stderr(), "fur: could not save state: %v\n", err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shabbyrobe/cmdy"
+	"github.com/shabbyrobe/cmdy/arg"
+	"github.com/shabbyrobe/fur/internal/tofu"
+)
+
+const tofuUsage = `
+The first time fur connects to a server using TLS, it remembers the server's public
+key, and checks it on every connection after that. If it changes, fur refuses to
+connect, unless a certificate authority vouches for the new certificate or -tofu=warn
+is passed. A pinned server that stops using TLS is refused or warned about the same
+way. Use 'fur tofu forget' to accept a server's new certificate.
+
+Pinning doesn't need certificate authorities, so self-signed certificates are accepted
+without -noverify. Certificates are pinned with -noverify too; pass -tofu=off to turn
+pinning off.
+
+Pins are stored in $XDG_DATA_HOME/fur/known_hosts, or the file in $FUR_KNOWN_HOSTS if
+set.
+`
+
+func tofuPath() (string, error) {
+	if file := os.Getenv("FUR_KNOWN_HOSTS"); file != "" {
+		return file, nil
+	}
+	dir, err := userDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "fur", "known_hosts"), nil
+}
+
+func loadPins(policy tofu.Policy) (*tofu.Store, error) {
+	file, err := tofuPath()
+	if err != nil {
+		return nil, err
+	}
+	return tofu.Load(file, policy)
+}
+
+func newTofuGroup() cmdy.Command {
+	return cmdy.NewGroup(
+		"Manage pinned TLS certificates",
+		cmdy.Builders{
+			"ls":     func() cmdy.Command { return &tofuListCommand{} },
+			"forget": func() cmdy.Command { return &tofuForgetCommand{} },
+		},
+		cmdy.GroupUsage(tofuUsage),
+	)
+}
+
+type tofuListCommand struct{}
+
+func (cmd *tofuListCommand) Help() cmdy.Help {
+	return cmdy.Synopsis("List pinned certificates")
+}
+
+func (cmd *tofuListCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {}
+
+func (cmd *tofuListCommand) Run(ctx cmdy.Context) error {
+	pins, err := loadPins(tofu.Strict)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(ctx.Stdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "HOST\tFINGERPRINT\tFIRST SEEN\n")
+	for _, pin := range pins.Pins() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", pin.Host, pin.Fingerprint, pin.Added.Local().Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+type tofuForgetCommand struct {
+	hosts []string
+}
+
+func (cmd *tofuForgetCommand) Help() cmdy.Help {
+	return cmdy.Help{
+		Synopsis: "Forget pinned certificates, so the next one seen is pinned instead",
+		Examples: cmdy.Examples{
+			cmdy.Example{Desc: "Forget every port on a host", Command: "gopher.example.com"},
+			cmdy.Example{Desc: "Forget one port", Command: "gopher.example.com:7443"},
+		},
+	}
+}
+
+func (cmd *tofuForgetCommand) Configure(flags *cmdy.FlagSet, args *arg.ArgSet) {
+	args.Remaining(&cmd.hosts, "host", arg.Min(1), "Hosts to forget, as 'host' for every port or 'host:port'")
+}
+
+func (cmd *tofuForgetCommand) Run(ctx cmdy.Context) error {
+	pins, err := loadPins(tofu.Strict)
+	if err != nil {
+		return err
+	}
+
+	for _, host := range cmd.hosts {
+		forgotten, err := pins.Forget(host)
+		if err != nil {
+			return err
+		}
+		if len(forgotten) == 0 {
+			return fmt.Errorf("no certificate pinned for %q", host)
+		}
+		for _, pin := range forgotten {
+			fmt.Fprintf(ctx.Stderr(), "forgot %s %s\n", pin.Host, pin.Fingerprint)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,391 @@
+// Package bench collects the results of load testing a gopher server, and reports them
+// like 'ab' or 'hey' would.
+package bench
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// Sample is the result of a single request.
+type Sample struct {
+	// URL that was requested, so results can be broken down by URL.
+	URL string
+
+	// Time until the first byte of the response arrived, and until the whole response
+	// had arrived.
+	TTFB  time.Duration
+	Total time.Duration
+
+	Bytes int64
+
+	// Status reported by the server, or OK if it didn't report one.
+	Status gopher.Status
+
+	// Err is a short description of the kind of error, like "timeout", if the request
+	// failed without the server reporting a status.
+	Err string
+
+	// Timing of each phase of the request, or nil if it wasn't timed.
+	Timing *furball.Timing
+}
+
+func (s Sample) Failed() bool { return s.Status != gopher.OK || s.Err != "" }
+
+// Stats collects Samples from any number of goroutines.
+type Stats struct {
+	mu       sync.Mutex
+	start    time.Time
+	ttfb     Histogram
+	total    Histogram
+	failed   int64
+	bytes    int64
+	statuses map[gopher.Status]int64
+	errors   map[string]int64
+	urls     map[string]*urlStats
+	phases   phaseStats
+}
+
+type phaseStats struct {
+	dns, connect, tls, ttfb, transfer Histogram
+}
+
+type urlStats struct {
+	total  Histogram
+	failed int64
+}
+
+func NewStats(start time.Time) *Stats {
+	return &Stats{
+		start:    start,
+		statuses: map[gopher.Status]int64{},
+		errors:   map[string]int64{},
+		urls:     map[string]*urlStats{},
+	}
+}
+
+func (s *Stats) Add(sm Sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ttfb.Add(sm.TTFB)
+	s.total.Add(sm.Total)
+	s.bytes += sm.Bytes
+	if sm.Err != "" {
+		s.errors[sm.Err]++
+	} else {
+		s.statuses[sm.Status]++
+	}
+	if sm.Failed() {
+		s.failed++
+	}
+
+	if t := sm.Timing; t != nil {
+		s.phases.dns.Add(time.Duration(t.DNS))
+		s.phases.connect.Add(time.Duration(t.Connect))
+		s.phases.tls.Add(time.Duration(t.TLS))
+		s.phases.ttfb.Add(time.Duration(t.TTFB))
+		s.phases.transfer.Add(time.Duration(t.Transfer))
+	}
+
+	us := s.urls[sm.URL]
+	if us == nil {
+		us = &urlStats{}
+		s.urls[sm.URL] = us
+	}
+	us.total.Add(sm.Total)
+	if sm.Failed() {
+		us.failed++
+	}
+}
+
+// Report on the samples added so far, as of now.
+func (s *Stats) Report(now time.Time) *Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := now.Sub(s.start)
+	rp := &Report{
+		Requests: s.total.Count(),
+		Failed:   s.failed,
+		Elapsed:  furball.Duration(elapsed),
+		Bytes:    s.bytes,
+		TTFB:     latencyOf(&s.ttfb),
+		Total:    latencyOf(&s.total),
+		Statuses: map[gopher.Status]int64{},
+		Errors:   map[string]int64{},
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		rp.RPS = float64(rp.Requests) / secs
+		rp.BytesPerSec = float64(rp.Bytes) / secs
+	}
+	for _, bar := range s.total.Bars(histogramBars) {
+		rp.Histogram = append(rp.Histogram, ReportBar{Upto: furball.Duration(bar.Upto), Count: bar.Count})
+	}
+	if s.phases.connect.Count() > 0 {
+		rp.Phases = &Phases{
+			DNS:      latencyOf(&s.phases.dns),
+			Connect:  latencyOf(&s.phases.connect),
+			TLS:      latencyOf(&s.phases.tls),
+			TTFB:     latencyOf(&s.phases.ttfb),
+			Transfer: latencyOf(&s.phases.transfer),
+		}
+	}
+	for status, n := range s.statuses {
+		rp.Statuses[status] = n
+	}
+	for err, n := range s.errors {
+		rp.Errors[err] = n
+	}
+
+	// A breakdown of a single URL would just repeat the rest of the report:
+	if len(s.urls) > 1 {
+		for u, us := range s.urls {
+			rp.URLs = append(rp.URLs, URLReport{
+				URL:      u,
+				Requests: us.total.Count(),
+				Failed:   us.failed,
+				Total:    latencyOf(&us.total),
+			})
+		}
+		sort.Slice(rp.URLs, func(i, j int) bool {
+			if rp.URLs[i].Requests != rp.URLs[j].Requests {
+				return rp.URLs[i].Requests > rp.URLs[j].Requests
+			}
+			return rp.URLs[i].URL < rp.URLs[j].URL
+		})
+	}
+	return rp
+}
+
+const histogramBars = 10
+
+// Report is a summary of a load test, which marshals to JSON. Durations are in
+// milliseconds.
+type Report struct {
+	// For open-loop tests, the rate requests were scheduled at once the test had
+	// ramped up, and the number of requests that were due but couldn't be sent before
+	// the test ended because every worker was busy. Latencies are measured from when
+	// each request was due rather than when it was sent.
+	TargetRPS float64 `json:"targetRps,omitempty"`
+	Missed    int64   `json:"missed,omitempty"`
+
+	Requests    int64                   `json:"requests"`
+	Failed      int64                   `json:"failed"`
+	Elapsed     furball.Duration        `json:"elapsed"`
+	RPS         float64                 `json:"rps"`
+	Bytes       int64                   `json:"bytes"`
+	BytesPerSec float64                 `json:"bytesPerSec"`
+	TTFB        Latency                 `json:"ttfb"`
+	Total       Latency                 `json:"total"`
+	Histogram   []ReportBar             `json:"histogram"`
+	Phases      *Phases                 `json:"phases,omitempty"`
+	Statuses    map[gopher.Status]int64 `json:"statuses"`
+	Errors      map[string]int64        `json:"errors"`
+
+	// URLs breaks the results down by URL, busiest first, if more than one was
+	// requested.
+	URLs []URLReport `json:"urls,omitempty"`
+}
+
+type URLReport struct {
+	URL      string  `json:"url"`
+	Requests int64   `json:"requests"`
+	Failed   int64   `json:"failed"`
+	Total    Latency `json:"total"`
+}
+
+// Phases breaks down the latency of the requests that connected by phase. The TTFB
+// phase is from when the request was sent, unlike Report.TTFB.
+type Phases struct {
+	DNS      Latency `json:"dns"`
+	Connect  Latency `json:"connect"`
+	TLS      Latency `json:"tls"`
+	TTFB     Latency `json:"ttfb"`
+	Transfer Latency `json:"transfer"`
+}
+
+type Latency struct {
+	Min  furball.Duration `json:"min"`
+	Mean furball.Duration `json:"mean"`
+	P50  furball.Duration `json:"p50"`
+	P90  furball.Duration `json:"p90"`
+	P99  furball.Duration `json:"p99"`
+	Max  furball.Duration `json:"max"`
+}
+
+func latencyOf(h *Histogram) Latency {
+	return Latency{
+		Min:  furball.Duration(h.Min()),
+		Mean: furball.Duration(h.Mean()),
+		P50:  furball.Duration(h.Percentile(0.5)),
+		P90:  furball.Duration(h.Percentile(0.9)),
+		P99:  furball.Duration(h.Percentile(0.99)),
+		Max:  furball.Duration(h.Max()),
+	}
+}
+
+// ReportBar is a Bar from the histogram of total times.
+type ReportBar struct {
+	Upto  furball.Duration `json:"upto"`
+	Count int64            `json:"count"`
+}
+
+// Progress summarises the report in a single line.
+func (rp *Report) Progress() string {
+	return fmt.Sprintf("%6.1fs %8d requests %8.1f rps  p50 %-8s p99 %-8s %d failed",
+		time.Duration(rp.Elapsed).Seconds(), rp.Requests, rp.RPS,
+		round(rp.Total.P50), round(rp.Total.P99), rp.Failed)
+}
+
+// WriteText writes the report in a form meant for people rather than programs.
+func (rp *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Summary:\n")
+	fmt.Fprintf(tw, "  Requests:\t%d\n", rp.Requests)
+	fmt.Fprintf(tw, "  Failed:\t%d\n", rp.Failed)
+	fmt.Fprintf(tw, "  Elapsed:\t%s\n", round(rp.Elapsed))
+	fmt.Fprintf(tw, "  Requests/sec:\t%.1f\n", rp.RPS)
+	if rp.TargetRPS > 0 {
+		fmt.Fprintf(tw, "  Target/sec:\t%.1f\n", rp.TargetRPS)
+		fmt.Fprintf(tw, "  Missed:\t%d\n", rp.Missed)
+	}
+	fmt.Fprintf(tw, "  Transferred:\t%d bytes (%s/sec)\n", rp.Bytes, byteSize(rp.BytesPerSec))
+	fmt.Fprintf(tw, "\n")
+
+	if rp.TargetRPS > 0 {
+		fmt.Fprintf(tw, "Latency (since due):\tFirst byte\tTotal\n")
+	} else {
+		fmt.Fprintf(tw, "Latency:\tFirst byte\tTotal\n")
+	}
+	for _, row := range []struct {
+		name        string
+		ttfb, total furball.Duration
+	}{
+		{"min", rp.TTFB.Min, rp.Total.Min},
+		{"mean", rp.TTFB.Mean, rp.Total.Mean},
+		{"p50", rp.TTFB.P50, rp.Total.P50},
+		{"p90", rp.TTFB.P90, rp.Total.P90},
+		{"p99", rp.TTFB.P99, rp.Total.P99},
+		{"max", rp.TTFB.Max, rp.Total.Max},
+	} {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", row.name, round(row.ttfb), round(row.total))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if ph := rp.Phases; ph != nil {
+		fmt.Fprintf(tw, "\nPhases:\tmean\tp50\tp90\tp99\tmax\n")
+		for _, row := range []struct {
+			name string
+			lat  Latency
+		}{
+			{"dns", ph.DNS},
+			{"connect", ph.Connect},
+			{"tls", ph.TLS},
+			{"ttfb", ph.TTFB},
+			{"transfer", ph.Transfer},
+		} {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\n", row.name,
+				round(row.lat.Mean), round(row.lat.P50), round(row.lat.P90), round(row.lat.P99), round(row.lat.Max))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(rp.Histogram) > 0 {
+		var most int64
+		for _, bar := range rp.Histogram {
+			if bar.Count > most {
+				most = bar.Count
+			}
+		}
+		fmt.Fprintf(tw, "\nTotal time histogram:\n")
+		for _, bar := range rp.Histogram {
+			fmt.Fprintf(tw, "  %s\t[%d]\t|%s\n", round(bar.Upto), bar.Count, strings.Repeat("■", int(40*bar.Count/most)))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(rp.Statuses) > 0 || len(rp.Errors) > 0 {
+		fmt.Fprintf(tw, "\nResponses:\n")
+		statuses := make([]gopher.Status, 0, len(rp.Statuses))
+		for status := range rp.Statuses {
+			statuses = append(statuses, status)
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i] < statuses[j] })
+		for _, status := range statuses {
+			name := "ok"
+			if status != gopher.OK {
+				name = fmt.Sprintf("status %d", status)
+			}
+			fmt.Fprintf(tw, "  %s\t%d\n", name, rp.Statuses[status])
+		}
+
+		errs := make([]string, 0, len(rp.Errors))
+		for err := range rp.Errors {
+			errs = append(errs, err)
+		}
+		sort.Strings(errs)
+		for _, err := range errs {
+			fmt.Fprintf(tw, "  %s\t%d\n", err, rp.Errors[err])
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(rp.URLs) > 0 {
+		fmt.Fprintf(tw, "\nBy URL:\tRequests\tFailed\tp50\tp90\tp99\n")
+		for _, ur := range rp.URLs {
+			fmt.Fprintf(tw, "  %s\t%d\t%d\t%s\t%s\t%s\n", ur.URL, ur.Requests, ur.Failed,
+				round(ur.Total.P50), round(ur.Total.P90), round(ur.Total.P99))
+		}
+	}
+	return tw.Flush()
+}
+
+// round durations to 3 significant figures or so, which is all the histogram is
+// accurate to.
+func round(d furball.Duration) time.Duration {
+	td := time.Duration(d)
+	switch {
+	case td >= 100*time.Second:
+		return td.Round(time.Second)
+	case td >= 10*time.Second:
+		return td.Round(100 * time.Millisecond)
+	case td >= time.Second:
+		return td.Round(10 * time.Millisecond)
+	case td >= 100*time.Millisecond:
+		return td.Round(time.Millisecond)
+	case td >= 10*time.Millisecond:
+		return td.Round(100 * time.Microsecond)
+	case td >= time.Millisecond:
+		return td.Round(10 * time.Microsecond)
+	default:
+		return td.Round(time.Microsecond)
+	}
+}
+
+func byteSize(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
@@ -0,0 +1,151 @@
+package bench
+
+import (
+	"math/bits"
+	"time"
+)
+
+// Durations are counted in buckets that are never more than 1/subBuckets of their
+// value wide, so percentiles are accurate to about 3%, and a Histogram uses the same
+// memory however many durations it counts. Durations shorter than 2*subBuckets
+// microseconds get a bucket each.
+const (
+	subBits    = 5
+	subBuckets = 1 << subBits
+)
+
+// Histogram of durations, with microsecond resolution.
+type Histogram struct {
+	counts []int64
+	n      int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+func bucketOf(d time.Duration) int {
+	v := uint64(d / time.Microsecond)
+	if v < 2*subBuckets {
+		return int(v)
+	}
+	e := bits.Len64(v) - subBits - 1
+	return 2*subBuckets + (e-1)*subBuckets + int(v>>uint(e)) - subBuckets
+}
+
+// bucketRange returns the smallest duration in bucket idx, and the bucket's width.
+func bucketRange(idx int) (lo, width time.Duration) {
+	if idx < 2*subBuckets {
+		return time.Duration(idx) * time.Microsecond, time.Microsecond
+	}
+	e := uint((idx-2*subBuckets)/subBuckets + 1)
+	v := uint64((idx-2*subBuckets)%subBuckets+subBuckets) << e
+	return time.Duration(v) * time.Microsecond, time.Duration(1<<e) * time.Microsecond
+}
+
+// Add a duration to the histogram. Negative durations are counted as 0.
+func (h *Histogram) Add(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	idx := bucketOf(d)
+	if idx >= len(h.counts) {
+		counts := make([]int64, idx+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[idx]++
+	if h.n == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.n++
+	h.sum += d
+}
+
+func (h *Histogram) Count() int64       { return h.n }
+func (h *Histogram) Min() time.Duration { return h.min }
+func (h *Histogram) Max() time.Duration { return h.max }
+
+func (h *Histogram) Mean() time.Duration {
+	if h.n == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.n)
+}
+
+// Percentile returns the duration that q (between 0 and 1) of the durations are less
+// than or equal to. It is the middle of the bucket the percentile falls in, so it is
+// only as accurate as the buckets are, but it is never outside Min and Max.
+func (h *Histogram) Percentile(q float64) time.Duration {
+	if h.n == 0 {
+		return 0
+	} else if q <= 0 {
+		return h.min
+	} else if q >= 1 {
+		return h.max
+	}
+	rank := int64(q*float64(h.n) + 0.5)
+	if rank < 1 {
+		rank = 1
+	} else if rank > h.n {
+		rank = h.n
+	}
+
+	var cum int64
+	for idx, c := range h.counts {
+		cum += c
+		if cum >= rank {
+			lo, width := bucketRange(idx)
+			d := lo + width/2
+			if d < h.min {
+				d = h.min
+			} else if d > h.max {
+				d = h.max
+			}
+			return d
+		}
+	}
+	return h.max
+}
+
+// Bar is a range of a Histogram, for drawing. Count is the number of durations
+// greater than the previous bar's Upto, and less than or equal to this one's.
+type Bar struct {
+	Upto  time.Duration
+	Count int64
+}
+
+// Bars splits the histogram between Min and Max into n bars of the same width.
+func (h *Histogram) Bars(n int) []Bar {
+	if h.n == 0 || n <= 0 {
+		return nil
+	}
+	width := (h.max - h.min) / time.Duration(n)
+	if width <= 0 {
+		return []Bar{{Upto: h.max, Count: h.n}}
+	}
+
+	bars := make([]Bar, n)
+	for i := range bars {
+		bars[i].Upto = h.min + width*time.Duration(i+1)
+	}
+	bars[n-1].Upto = h.max
+
+	for idx, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		lo, bw := bucketRange(idx)
+		d := lo + bw/2
+		i := int((d - h.min) / width)
+		if d <= h.min {
+			i = 0
+		} else if i >= n {
+			i = n - 1
+		}
+		bars[i].Count += c
+	}
+	return bars
+}
@@ -0,0 +1,63 @@
+package bench
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestBuckets(t *testing.T) {
+	// Every duration must land in a bucket whose range contains it, and the buckets
+	// must be in order:
+	last := -1
+	for us := int64(0); us < 1<<20; us += 1 + us/100 {
+		d := time.Duration(us) * time.Microsecond
+		idx := bucketOf(d)
+		lo, width := bucketRange(idx)
+		if d < lo || d >= lo+width {
+			t.Fatalf("%s in bucket %d: [%s, %s)", d, idx, lo, lo+width)
+		}
+		if idx < last {
+			t.Fatalf("%s in bucket %d after %d", d, idx, last)
+		}
+		if us >= 2*subBuckets && float64(width)/float64(lo) > 1.0/subBuckets {
+			t.Fatalf("bucket %d too wide: %s at %s", idx, width, lo)
+		}
+		last = idx
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var h Histogram
+	var ds []time.Duration
+	for i := 0; i < 10000; i++ {
+		d := time.Duration(rng.ExpFloat64() * float64(5*time.Millisecond))
+		ds = append(ds, d)
+		h.Add(d)
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		exact := ds[int(q*float64(len(ds)))-1]
+		result := h.Percentile(q)
+		if diff := float64(result-exact) / float64(exact); diff > 0.04 || diff < -0.04 {
+			t.Fatalf("p%.0f: %s != %s", q*100, result, exact)
+		}
+	}
+	if h.Percentile(1) != ds[len(ds)-1] || h.Max() != ds[len(ds)-1] {
+		t.Fatal("max", h.Percentile(1), h.Max())
+	}
+	if h.Percentile(0) != ds[0] || h.Min() != ds[0] {
+		t.Fatal("min", h.Percentile(0), h.Min())
+	}
+
+	var total int64
+	for _, bar := range h.Bars(10) {
+		total += bar.Count
+	}
+	if total != h.Count() {
+		t.Fatal(total, h.Count())
+	}
+}
@@ -0,0 +1,38 @@
+package bench
+
+import (
+	"math"
+	"time"
+)
+
+// Schedule of when to send requests in an open-loop test, where requests are sent when
+// they are due whether or not earlier ones have finished, so a slow server can't slow
+// the test down and hide how slow it is.
+//
+// Requests are sent at Rate per second, after ramping up linearly from 0 over Ramp.
+type Schedule struct {
+	Rate float64
+	Ramp time.Duration
+}
+
+// At returns when request i, counting from 0, is due, relative to the start of the
+// test.
+func (s Schedule) At(i int64) time.Duration {
+	if s.Rate <= 0 {
+		return 0
+	}
+	n := float64(i)
+	ramp := s.Ramp.Seconds()
+
+	// During the ramp, the rate at time t is Rate*t/ramp, so by time t,
+	// Rate*t*t/(2*ramp) requests are due:
+	inRamp := s.Rate * ramp / 2
+	if n < inRamp {
+		return seconds(math.Sqrt(2 * ramp * n / s.Rate))
+	}
+	return s.Ramp + seconds((n-inRamp)/s.Rate)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
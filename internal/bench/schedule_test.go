@@ -0,0 +1,40 @@
+package bench
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	for idx, tc := range []struct {
+		sched Schedule
+		i     int64
+		at    time.Duration
+	}{
+		{Schedule{Rate: 10}, 0, 0},
+		{Schedule{Rate: 10}, 1, 100 * time.Millisecond},
+		{Schedule{Rate: 10}, 25, 2500 * time.Millisecond},
+
+		// 8 rps after ramping up over 2s, so 8 requests are sent during the ramp, the
+		// first quarter of them in the first half:
+		{Schedule{Rate: 8, Ramp: 2 * time.Second}, 0, 0},
+		{Schedule{Rate: 8, Ramp: 2 * time.Second}, 2, 1 * time.Second},
+		{Schedule{Rate: 8, Ramp: 2 * time.Second}, 8, 2 * time.Second},
+		{Schedule{Rate: 8, Ramp: 2 * time.Second}, 10, 2250 * time.Millisecond},
+	} {
+		if result := tc.sched.At(tc.i); result != tc.at {
+			t.Fatalf("%d: %s != %s", idx, result, tc.at)
+		}
+	}
+
+	// Requests must never be due before the one before them:
+	sched := Schedule{Rate: 1000, Ramp: 10 * time.Second}
+	var last time.Duration
+	for i := int64(0); i < 20000; i++ {
+		at := sched.At(i)
+		if at < last {
+			t.Fatal(i, at, last)
+		}
+		last = at
+	}
+}
@@ -0,0 +1,212 @@
+package bench
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// Target is a request to send in a load test.
+type Target struct {
+	URL gopher.URL
+
+	// How often the target is picked, relative to the other targets' weights.
+	Weight float64
+
+	// GopherIIbis format and data block, if any.
+	Format string
+	Body   []byte
+
+	// In a replay, when the target is due, relative to the start of the test.
+	At time.Duration
+}
+
+// Request builds a new request for the target. Requests can't be reused, as sending one
+// consumes its body.
+func (t *Target) Request() (*gopher.Request, error) {
+	var body io.Reader
+	if len(t.Body) > 0 {
+		body = bytes.NewReader(t.Body)
+	}
+	if t.Format != "" {
+		return gopher.NewFormatRequest(t.URL, t.Format, body)
+	}
+	return gopher.NewRequest(t.URL, body), nil
+}
+
+// Workload is the set of requests to send in a load test. Normally targets are picked at
+// random by weight for as long as the test runs, but a Replay sends each target once, in
+// order, when it is due.
+type Workload struct {
+	Targets []Target
+	Replay  bool
+
+	weights []float64 // Running total of the weights, for Pick
+}
+
+// NewWorkload creates a workload that picks from targets by weight.
+func NewWorkload(targets []Target) (*Workload, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("bench: workload has no targets")
+	}
+	wl := &Workload{Targets: targets}
+	var total float64
+	for _, t := range targets {
+		if t.Weight <= 0 {
+			return nil, fmt.Errorf("bench: weight for %q must be > 0", t.URL)
+		}
+		total += t.Weight
+		wl.weights = append(wl.weights, total)
+	}
+	return wl, nil
+}
+
+// Pick the index of a target at random, by weight.
+func (wl *Workload) Pick(rnd *rand.Rand) int {
+	if len(wl.Targets) == 1 {
+		return 0
+	}
+	n := rnd.Float64() * wl.weights[len(wl.weights)-1]
+	idx := sort.SearchFloat64s(wl.weights, n)
+	if idx >= len(wl.Targets) {
+		idx = len(wl.Targets) - 1
+	}
+	return idx
+}
+
+// ParseWorkload reads a workload file, which lists a URL per line, each optionally
+// preceded by a weight (the default is 1), and optionally followed by a tab and search
+// terms, which override any in the URL. Blank lines and lines starting with '#' are
+// ignored:
+//
+//	# Half the requests are for the front page:
+//	2 gopher://localhost/1/
+//	gopher://localhost/0/about.txt
+//	gopher://localhost/7/search	cats and dogs
+func ParseWorkload(rdr io.Reader) (*Workload, error) {
+	var targets []Target
+	scn := bufio.NewScanner(rdr)
+	line := 0
+	for scn.Scan() {
+		line++
+		text := strings.TrimRight(scn.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(strings.TrimSpace(text), "#") {
+			continue
+		}
+
+		var search string
+		if idx := strings.IndexByte(text, '\t'); idx >= 0 {
+			text, search = text[:idx], text[idx+1:]
+		}
+
+		t := Target{Weight: 1}
+		fields := strings.Fields(text)
+		switch len(fields) {
+		case 1:
+		case 2:
+			w, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bench: workload line %d: invalid weight %q", line, fields[0])
+			}
+			t.Weight = w
+			fields = fields[1:]
+		default:
+			return nil, fmt.Errorf("bench: workload line %d: expected '[<weight>] <url>[<TAB><search>]'", line)
+		}
+
+		u, err := gopher.ParseURL(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("bench: workload line %d: %w", line, err)
+		}
+		if search != "" {
+			u.Search = search
+		}
+		if u.ItemType.IsSearch() && u.Search == "" {
+			return nil, fmt.Errorf("bench: workload line %d: %q requires a search term", line, u)
+		}
+		t.URL = u
+		targets = append(targets, t)
+	}
+	if err := scn.Err(); err != nil {
+		return nil, fmt.Errorf("bench: read workload failed: %w", err)
+	}
+	return NewWorkload(targets)
+}
+
+// LoadWorkloadFile parses the workload file at path; see ParseWorkload.
+func LoadWorkloadFile(path string) (*Workload, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("bench: load workload %q failed: %w", path, err)
+	}
+	defer f.Close()
+
+	wl, err := ParseWorkload(f)
+	if err != nil {
+		return nil, fmt.Errorf("bench: load workload %q failed: %w", path, err)
+	}
+	return wl, nil
+}
+
+// ReplayBall creates a workload that replays the requests recorded in a furball, with
+// the same timing relative to the first one. The recorded request is sent as it was,
+// including any GopherIIbis format and data block. Entries recorded without a request
+// are rebuilt from their URL.
+func ReplayBall(ball *furball.Ball) (*Workload, error) {
+	if len(ball.Entries) == 0 {
+		return nil, fmt.Errorf("bench: furball has no entries to replay")
+	}
+
+	entries := make([]furball.Entry, len(ball.Entries))
+	copy(entries, ball.Entries)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].At.Before(entries[j].At) })
+
+	first := entries[0].At
+	wl := &Workload{Replay: true}
+	for _, e := range entries {
+		t := requestTarget(e.URL, e.In)
+		t.Weight = 1
+		t.At = e.At.Sub(first)
+		wl.Targets = append(wl.Targets, t)
+	}
+	return wl, nil
+}
+
+// requestTarget parses a raw request recorded for u, which looks like this, where the
+// search, format, data flag and data block are all optional:
+//
+//	<selector>\t<search>\t<format><data flag>\r\n<data block>
+//
+// If the request can't be parsed, only u is used.
+func requestTarget(u gopher.URL, in []byte) Target {
+	t := Target{URL: u}
+	end := bytes.Index(in, []byte("\r\n"))
+	if end < 0 {
+		return t
+	}
+
+	fields := strings.Split(string(in[:end]), "\t")
+	t.URL.Selector = fields[0]
+	t.URL.Search = ""
+	if len(fields) > 1 {
+		t.URL.Search = fields[1]
+	}
+	if len(fields) > 2 && fields[2] != "" {
+		format, flag := fields[2][:len(fields[2])-1], fields[2][len(fields[2])-1]
+		t.Format = format
+		if flag == '1' {
+			t.Body = in[end+2:]
+		}
+	}
+	return t
+}
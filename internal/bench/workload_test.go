@@ -0,0 +1,90 @@
+package bench
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+func TestParseWorkload(t *testing.T) {
+	wl, err := ParseWorkload(strings.NewReader("" +
+		"# comment\n" +
+		"\n" +
+		"2.5 gopher://localhost/1/\r\n" +
+		"gopher://localhost:7070/0/about.txt\n" +
+		"gopher://localhost/7/search\tcats and dogs\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, tc := range []struct {
+		url    string
+		search string
+		weight float64
+	}{
+		{"gopher://localhost/1/", "", 2.5},
+		{"gopher://localhost:7070/0/about.txt", "", 1},
+		{"gopher://localhost/7/search", "cats and dogs", 1},
+	} {
+		target := wl.Targets[idx]
+		if target.URL.Selector != gopher.MustParseURL(tc.url).Selector || target.URL.Search != tc.search {
+			t.Fatalf("%d: unexpected URL %q", idx, target.URL)
+		}
+		if target.Weight != tc.weight {
+			t.Fatalf("%d: weight %g != %g", idx, target.Weight, tc.weight)
+		}
+	}
+
+	for idx, in := range []string{
+		"",
+		"# nothing\n",
+		"x gopher://localhost/1/\n",
+		"0 gopher://localhost/1/\n",
+		"1 2 gopher://localhost/1/\n",
+		"gopher://localhost/7/search\n",
+	} {
+		if _, err := ParseWorkload(strings.NewReader(in)); err == nil {
+			t.Fatalf("%d: expected error for %q", idx, in)
+		}
+	}
+}
+
+func TestReplayBall(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ball := &furball.Ball{Entries: []furball.Entry{
+		{URL: gopher.MustParseURL("gopher://localhost/7/search%09cats"), At: start.Add(time.Second), In: []byte("/search\tcats\r\n")},
+		{URL: gopher.MustParseURL("gopher://localhost/1/"), At: start},
+		{URL: gopher.MustParseURL("gopher://localhost/0/post"), At: start.Add(3 * time.Second), In: []byte("/post\t\ttext/plain1\r\nhello")},
+	}}
+
+	wl, err := ReplayBall(ball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wl.Replay || len(wl.Targets) != 3 {
+		t.Fatal("unexpected workload", wl)
+	}
+
+	for idx, tc := range []struct {
+		selector, search, format, body string
+		at                             time.Duration
+	}{
+		{"/", "", "", "", 0},
+		{"/search", "cats", "", "", time.Second},
+		{"/post", "", "text/plain", "hello", 3 * time.Second},
+	} {
+		target := wl.Targets[idx]
+		if target.URL.Selector != tc.selector || target.URL.Search != tc.search {
+			t.Fatalf("%d: unexpected URL %q", idx, target.URL)
+		}
+		if target.Format != tc.format || string(target.Body) != tc.body {
+			t.Fatalf("%d: unexpected format %q or body %q", idx, target.Format, target.Body)
+		}
+		if target.At != tc.at {
+			t.Fatalf("%d: %s != %s", idx, target.At, tc.at)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package bookmark
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// Bookmarks are stored as a gophermap, one dirent per bookmark, so the file can be
+// rendered like any other menu or dropped straight into a gopherhole.
+//
+// Tags don't have anywhere to live in a dirent, so they are appended to the display
+// string in square brackets:
+//
+//	1Floodgap [home gopher]	/	gopher.floodgap.com	70
+type Bookmark struct {
+	Name string
+	Tags []string
+	URL  gopher.URL
+}
+
+func New(u gopher.URL, name string, tags []string) (Bookmark, error) {
+	if u.Hostname == "" {
+		return Bookmark{}, fmt.Errorf("bookmark: URL %q has no host", u)
+	}
+	if u.ItemType == gopher.Info || u.ItemType == gopher.ItemError {
+		return Bookmark{}, fmt.Errorf("bookmark: URL %q is not a link", u)
+	}
+	if u.Search != "" {
+		return Bookmark{}, fmt.Errorf("bookmark: URL %q must not contain a search", u)
+	}
+	if strings.ContainsAny(u.Selector, "\t\r\n") {
+		return Bookmark{}, fmt.Errorf("bookmark: URL %q selector contains invalid characters", u)
+	}
+	if name == "" {
+		name = u.String()
+	}
+	name = strings.Join(strings.Fields(name), " ")
+	for _, tag := range tags {
+		if tag == "" || strings.ContainsAny(tag, " \t\r\n[]") {
+			return Bookmark{}, fmt.Errorf("bookmark: invalid tag %q", tag)
+		}
+	}
+	if u.Root {
+		u.Root = false
+		u.ItemType = gopher.Dir
+	}
+	return Bookmark{Name: name, Tags: tags, URL: u}, nil
+}
+
+func (b Bookmark) HasTag(tag string) bool {
+	for _, t := range b.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (b Bookmark) Display() string {
+	if len(b.Tags) == 0 {
+		return b.Name
+	}
+	return fmt.Sprintf("%s [%s]", b.Name, strings.Join(b.Tags, " "))
+}
+
+func (b Bookmark) Dirent() gopher.Dirent {
+	port := b.URL.Port
+	if port == "" {
+		port = "70"
+	}
+	return gopher.Dirent{
+		ItemType: b.URL.ItemType,
+		Display:  b.Display(),
+		Selector: b.URL.Selector,
+		Hostname: b.URL.Hostname,
+		Port:     port,
+	}
+}
+
+func fromDirent(d *gopher.Dirent) Bookmark {
+	name, tags := d.Display, []string(nil)
+	if strings.HasSuffix(name, "]") {
+		if idx := strings.LastIndex(name, " ["); idx >= 0 {
+			tags = strings.Fields(name[idx+2 : len(name)-1])
+			name = name[:idx]
+		}
+	}
+	return Bookmark{Name: name, Tags: tags, URL: d.URL()}
+}
+
+// Bookmarks is an ordered list of bookmarks. Order is preserved when the list is
+// written, so numbers shown when a list is rendered can be used to refer to them.
+type Bookmarks []Bookmark
+
+// Find a bookmark by exact name, or by number, starting at 1. Returns -1 if not found.
+func (bs Bookmarks) Find(ref string) int {
+	for i, b := range bs {
+		if b.Name == ref {
+			return i
+		}
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 1 && n <= len(bs) {
+		return n - 1
+	}
+	return -1
+}
+
+// Put adds the bookmark, replacing any existing bookmark with the same name.
+func (bs Bookmarks) Put(b Bookmark) Bookmarks {
+	for i := range bs {
+		if bs[i].Name == b.Name {
+			bs[i] = b
+			return bs
+		}
+	}
+	return append(bs, b)
+}
+
+func (bs Bookmarks) Remove(idx int) Bookmarks {
+	return append(bs[:idx:idx], bs[idx+1:]...)
+}
+
+func Read(rdr io.Reader) (Bookmarks, error) {
+	var bs Bookmarks
+	var dirent gopher.Dirent
+	dr := gopher.NewDirReader(rdr)
+	for dr.Read(&dirent) {
+		if dirent.ItemType == gopher.Info || dirent.ItemType == gopher.ItemError {
+			continue
+		}
+		bs = append(bs, fromDirent(&dirent))
+	}
+	if err := dr.ReadErr(); err != nil {
+		return bs, fmt.Errorf("bookmark: read failed: %w", err)
+	}
+	return bs, nil
+}
+
+// Write the bookmarks as a gophermap. The '.' terminator is not written, as gophermap
+// files are not expected to contain one.
+func Write(w io.Writer, bs Bookmarks) error {
+	bw := bufio.NewWriter(w)
+	for _, b := range bs {
+		d := b.Dirent()
+		fmt.Fprintf(bw, "%c%s\t%s\t%s\t%s\n", d.ItemType, d.Display, d.Selector, d.Hostname, d.Port)
+	}
+	return bw.Flush()
+}
+
+// LoadFile loads bookmarks from the file at path. If the file does not exist, an empty
+// list is returned.
+func LoadFile(path string) (Bookmarks, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("bookmark: load file %q failed: %w", path, err)
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+func SaveFile(bs Bookmarks, path string) (rerr error) {
+	var b [16]byte
+	rand.Read(b[:])
+
+	tmpPath := path + "." + hex.EncodeToString(b[:])
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("bookmark: save file %q failed: %w", path, err)
+	}
+	defer func() {
+		if f != nil {
+			f.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if err := Write(f, bs); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	f = nil
+
+	return os.Rename(tmpPath, path)
+}
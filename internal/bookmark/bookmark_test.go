@@ -0,0 +1,142 @@
+package bookmark
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+func TestNew(t *testing.T) {
+	for idx, tc := range []struct {
+		url  string
+		name string
+		tags []string
+		out  string // Name, or "" if New should fail
+	}{
+		{"gopher://localhost/1/foo", "foo", nil, "foo"},
+		{"gopher://localhost/1/foo", "", nil, "gopher://localhost/1/foo"},
+		{"gopher://localhost/1/foo", "  foo \t bar ", nil, "foo bar"},
+		{"gopher://localhost/1/foo", "foo", []string{"a", "b"}, "foo"},
+		{"gopher://localhost/1/foo", "foo", []string{"a b"}, ""},
+		{"gopher://localhost/1/foo", "foo", []string{"a]"}, ""},
+		{"gopher://localhost/1/foo", "foo", []string{""}, ""},
+		{"gopher://localhost/7/foo%09bar", "foo", nil, ""},
+		{"gopher://localhost/i/foo", "foo", nil, ""},
+		{"gopher://localhost/3/foo", "foo", nil, ""},
+	} {
+		bm, err := New(gopher.MustParseURL(tc.url), tc.name, tc.tags)
+		if (err == nil) != (tc.out != "") {
+			t.Fatal(idx, err)
+		} else if err == nil && bm.Name != tc.out {
+			t.Fatalf("%d: name %q != %q", idx, bm.Name, tc.out)
+		}
+	}
+
+	bm, err := New(gopher.MustParseURL("gopher://localhost"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if bm.URL.Root || bm.URL.ItemType != gopher.Dir {
+		t.Fatalf("root URL not stored as a menu: %+v", bm.URL)
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	in := "" +
+		"iNot a bookmark\t\terror.host\t1\n" +
+		"3Nor this\t\terror.host\t1\n" +
+		"1Floodgap [home gopher]\t/\tgopher.floodgap.com\t70\n" +
+		"0About [x]\t/about.txt\tlocalhost\t7070\n" +
+		"1Brackets [in] the name\t/\tlocalhost\t70\n"
+
+	bms, err := Read(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, tc := range []struct {
+		name string
+		tags []string
+		url  string
+	}{
+		{"Floodgap", []string{"home", "gopher"}, "gopher://gopher.floodgap.com/1/"},
+		{"About", []string{"x"}, "gopher://localhost:7070/0/about.txt"},
+		{"Brackets [in] the name", nil, "gopher://localhost/1/"},
+	} {
+		bm := bms[idx]
+		if bm.Name != tc.name || strings.Join(bm.Tags, " ") != strings.Join(tc.tags, " ") {
+			t.Fatalf("%d: unexpected name %q or tags %q", idx, bm.Name, bm.Tags)
+		}
+		if bm.URL != gopher.MustParseURL(tc.url) {
+			t.Fatalf("%d: URL %q != %q", idx, bm.URL, tc.url)
+		}
+	}
+	if len(bms) != 3 {
+		t.Fatal(len(bms))
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, bms); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != strings.SplitN(in, "\n", 3)[2] {
+		t.Fatalf("round trip failed:\n%s", buf.String())
+	}
+	if !bms[0].HasTag("gopher") || bms[0].HasTag("x") || bms[2].HasTag("in") {
+		t.Fatal("unexpected tags")
+	}
+}
+
+func TestBookmarks(t *testing.T) {
+	mk := func(name string) Bookmark {
+		bm, err := New(gopher.MustParseURL("gopher://localhost/1/"+name), name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bm
+	}
+	names := func(bms Bookmarks) string {
+		var out []string
+		for _, bm := range bms {
+			out = append(out, bm.Name)
+		}
+		return strings.Join(out, ",")
+	}
+
+	var bms Bookmarks
+	for _, name := range []string{"a", "b", "2", "c"} {
+		bms = bms.Put(mk(name))
+	}
+	replaced := mk("b")
+	replaced.URL.Selector = "/replaced"
+	bms = bms.Put(replaced)
+	if names(bms) != "a,b,2,c" || bms[1].URL.Selector != "/replaced" {
+		t.Fatal(names(bms), bms[1].URL)
+	}
+
+	for idx, tc := range []struct {
+		ref string
+		idx int
+	}{
+		{"a", 0},
+		{"c", 3},
+		{"1", 0},
+		{"4", 3},
+		{"2", 2}, // Names take precedence over numbers
+		{"5", -1},
+		{"0", -1},
+		{"nope", -1},
+	} {
+		if found := bms.Find(tc.ref); found != tc.idx {
+			t.Fatalf("%d: find %q: %d != %d", idx, tc.ref, found, tc.idx)
+		}
+	}
+
+	if names(bms.Remove(1)) != "a,2,c" {
+		t.Fatal(names(bms.Remove(1)))
+	}
+	if names(bms) != "a,b,2,c" {
+		t.Fatal("Remove modified the original list:", names(bms))
+	}
+}
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shabbyrobe/fur/internal/flatdump"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const fileExt = ".dump"
+
+// Cache stores raw Gopher responses on disk, one flatdump file per URL. Files are named
+// after a hash of the normalised URL, which includes the item type, so the same
+// selector requested as a different type is cached separately.
+type Cache struct {
+	Dir string
+
+	// Entries older than TTL are treated as missing by Get. If TTL is <= 0, entries
+	// never expire.
+	TTL time.Duration
+}
+
+func New(dir string, ttl time.Duration) *Cache {
+	return &Cache{Dir: dir, TTL: ttl}
+}
+
+type Entry struct {
+	URL  gopher.URL
+	At   time.Time
+	Size int64
+	File string
+}
+
+// Normalize returns the form of u that is used to key the cache. Gopher and gophers
+// URLs share an entry, as TLS only changes how the response is fetched.
+func Normalize(u gopher.URL) gopher.URL {
+	u.Scheme = "gopher"
+	u.Hostname = strings.ToLower(u.Hostname)
+	if u.Port == "" {
+		u.Port = "70"
+	}
+	if u.Root {
+		u.Root = false
+		u.ItemType = gopher.Dir
+		u.Selector = ""
+	}
+	return u
+}
+
+func (c *Cache) file(u gopher.URL) string {
+	sum := sha256.Sum256([]byte(Normalize(u).String()))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:])+fileExt)
+}
+
+// Get returns the cached response for u. If there is no response for u, or the
+// response has expired, ok is false.
+func (c *Cache) Get(u gopher.URL, now time.Time) (data []byte, at time.Time, ok bool, err error) {
+	f, err := os.Open(c.file(u))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, at, false, nil
+	} else if err != nil {
+		return nil, at, false, fmt.Errorf("cache: get %q failed: %w", u, err)
+	}
+	defer f.Close()
+
+	dump, err := flatdump.ReadFlatDump(f)
+	if err != nil {
+		return nil, at, false, fmt.Errorf("cache: get %q failed: %w", u, err)
+	}
+	if c.TTL > 0 && now.Sub(dump.At) > c.TTL {
+		return nil, dump.At, false, nil
+	}
+
+	// Guard against hash collisions, however unlikely:
+	if Normalize(dump.URL) != Normalize(u) {
+		return nil, at, false, nil
+	}
+
+	data, err = ioutil.ReadAll(dump)
+	if err != nil {
+		return nil, at, false, fmt.Errorf("cache: get %q failed: %w", u, err)
+	}
+	return data, dump.At, true, nil
+}
+
+func (c *Cache) Put(u gopher.URL, at time.Time, data []byte) (rerr error) {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+
+	var b [16]byte
+	rand.Read(b[:])
+
+	path := c.file(u)
+	tmpPath := path + "." + hex.EncodeToString(b[:])
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("cache: put %q failed: %w", u, err)
+	}
+	defer func() {
+		if f != nil {
+			f.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := flatdump.WriteFlatDumpHeader(f, Normalize(u), at); err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	f = nil
+
+	return os.Rename(tmpPath, path)
+}
+
+// List all entries in the cache, including expired entries, most recent first.
+func (c *Cache) List() ([]Entry, error) {
+	files, err := filepath.Glob(filepath.Join(c.Dir, "*"+fileExt))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(files))
+	for _, file := range files {
+		entry, err := readEntry(file)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].At.After(entries[j].At)
+	})
+	return entries, nil
+}
+
+// Purge removes entries from the cache that were stored before the time passed in
+// 'before'. If before is zero, all entries are removed.
+func (c *Cache) Purge(before time.Time) (n int, err error) {
+	entries, err := c.List()
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if !before.IsZero() && !entry.At.Before(before) {
+			continue
+		}
+		if err := os.Remove(entry.File); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func readEntry(file string) (entry Entry, rerr error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return entry, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return entry, err
+	}
+
+	dump, err := flatdump.ReadFlatDump(f)
+	if err != nil {
+		return entry, fmt.Errorf("cache: invalid entry %q: %w", file, err)
+	}
+
+	// Everything after the header is the response:
+	hdr, _ := flatdump.WriteFlatDumpHeader(ioutil.Discard, dump.URL, dump.At)
+
+	return Entry{
+		URL:  dump.URL,
+		At:   dump.At,
+		Size: info.Size() - int64(hdr),
+		File: file,
+	}, nil
+}
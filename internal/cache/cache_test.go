@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+func TestNormalize(t *testing.T) {
+	for idx, tc := range []struct {
+		in, out string
+	}{
+		{"gopher://localhost/1/foo", "gopher://localhost:70/1/foo"},
+		{"gophers://localhost/1/foo", "gopher://localhost:70/1/foo"},
+		{"gopher://LocalHost:7070/0/Foo", "gopher://localhost:7070/0/Foo"},
+		{"gopher://localhost", "gopher://localhost:70/1"},
+		{"gopher://localhost/", "gopher://localhost:70/1"},
+		{"gopher://localhost/1", "gopher://localhost:70/1"},
+	} {
+		u := Normalize(gopher.MustParseURL(tc.in))
+		if u != Normalize(gopher.MustParseURL(tc.out)) {
+			t.Fatalf("%d: %q normalized to %q, expected %q", idx, tc.in, u, tc.out)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New(dir, time.Hour)
+	if err := c.Put(gopher.MustParseURL("gopher://localhost/1/foo"), at, []byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, tc := range []struct {
+		url string
+		ttl time.Duration
+		now time.Time
+		ok  bool
+	}{
+		{"gopher://localhost/1/foo", time.Hour, at, true},
+		{"gopher://localhost/1/foo", time.Hour, at.Add(time.Hour), true},
+		{"gopher://localhost/1/foo", time.Hour, at.Add(time.Hour + 1), false},
+		{"gopher://localhost/1/foo", 0, at.Add(24 * time.Hour), true},
+		{"gophers://LOCALHOST:70/1/foo", time.Hour, at, true},
+		{"gopher://localhost/0/foo", time.Hour, at, false},
+		{"gopher://localhost:7070/1/foo", time.Hour, at, false},
+		{"gopher://localhost/1/bar", time.Hour, at, false},
+	} {
+		c.TTL = tc.ttl
+		data, _, ok, err := c.Get(gopher.MustParseURL(tc.url), tc.now)
+		if err != nil {
+			t.Fatal(idx, err)
+		}
+		if ok != tc.ok {
+			t.Fatalf("%d: %q ok %v != %v", idx, tc.url, ok, tc.ok)
+		}
+		if ok && string(data) != "foo" {
+			t.Fatalf("%d: unexpected data %q", idx, data)
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for idx, tc := range []struct {
+		before time.Time
+		purged int
+	}{
+		{time.Time{}, 3},
+		{at, 0},
+		{at.Add(time.Minute), 1},
+		{at.Add(time.Hour), 1},
+		{at.Add(time.Hour + 1), 2},
+		{at.Add(2*time.Hour + 1), 3},
+	} {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		c := New(dir, 0)
+		for i, sel := range []string{"/a", "/b", "/c"} {
+			u := gopher.URL{Hostname: "localhost", ItemType: gopher.Text, Selector: sel}
+			if err := c.Put(u, at.Add(time.Duration(i)*time.Hour), []byte(sel)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		n, err := c.Purge(tc.before)
+		if err != nil {
+			t.Fatal(idx, err)
+		} else if n != tc.purged {
+			t.Fatalf("%d: purged %d != %d", idx, n, tc.purged)
+		}
+
+		entries, err := c.List()
+		if err != nil {
+			t.Fatal(idx, err)
+		} else if len(entries) != 3-tc.purged {
+			t.Fatalf("%d: %d entries left", idx, len(entries))
+		}
+		for i := 1; i < len(entries); i++ {
+			if entries[i].At.After(entries[i-1].At) {
+				t.Fatalf("%d: entries not most recent first", idx)
+			}
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package caps
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// Magic must be the first four bytes of every caps file. A response that does not start
+// with it is presumed to be some kind of error.
+const Magic = "CAPS"
+
+// Selector that servers are expected to serve the caps file from.
+const Selector = "caps.txt"
+
+// MaxSize is the largest caps file Parse will accept.
+const MaxSize = 1 << 17
+
+const (
+	KeyVersion            = "CapsVersion"
+	KeyExpireAfter        = "ExpireCapsAfter"
+	KeyPathDelimiter      = "PathDelimeter" // sic; see lookupPath
+	KeyPathIdentity       = "PathIdentity"
+	KeyPathParent         = "PathParent"
+	KeyPathParentDouble   = "PathParentDouble"
+	KeyPathEscape         = "PathEscapeCharacter"
+	KeyPathKeepPreDelim   = "PathKeepPreDelimeter" // sic; see lookupPath
+	KeyServerSoftware     = "ServerSoftware"
+	KeyServerVersion      = "ServerSoftwareVersion"
+	KeyServerArchitecture = "ServerArchitecture"
+	KeyServerDescription  = "ServerDescription"
+	KeyServerGeolocation  = "ServerGeolocationString"
+	KeyServerAdmin        = "ServerAdmin"
+	KeyServerTLSPort      = "ServerTLSPort"
+	KeyDefaultEncoding    = "ServerDefaultEncoding"
+	KeySupportsII         = "SupportsGopherII"
+	KeySupportsIIbis      = "SupportsGopherIIbis"
+	KeySupportsPlusAsk    = "SupportsGopherPlusAsk"
+)
+
+type Pair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// File is a parsed caps.txt. Keys are matched case-insensitively; if a key appears more
+// than once, the last value wins. Keys the parser doesn't know about are kept, so they
+// can still be displayed.
+//
+// File implements gopher.Caps. Missing or invalid values fall back to the defaults in
+// gopher.DefaultCaps.
+type File struct {
+	Pairs    []Pair
+	Comments []string
+
+	index map[string]int
+}
+
+var _ gopher.Caps = &File{}
+
+// Parse a caps file. The magic is required; blank lines and lines starting with '#' are
+// ignored, and every other line must be a 'key=value' pair. Whitespace around the '='
+// is discarded. Some servers append a '.' line to the file as if it were a menu, so
+// parsing stops at the first line containing only a '.'.
+func Parse(rdr io.Reader) (*File, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(rdr, MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("caps: read failed: %w", err)
+	}
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("caps: file larger than %d bytes", MaxSize)
+	}
+	return ParseBytes(data)
+}
+
+func ParseBytes(data []byte) (*File, error) {
+	if !bytes.HasPrefix(data, []byte(Magic)) {
+		return nil, fmt.Errorf("caps: missing %q magic", Magic)
+	}
+
+	f := &File{index: map[string]int{}}
+
+	scn := bufio.NewScanner(bytes.NewReader(data[len(Magic):]))
+	scn.Buffer(make([]byte, 0, 4096), MaxSize)
+
+	for lnum := 1; scn.Scan(); lnum++ {
+		line := strings.TrimRight(scn.Text(), "\r")
+
+		// The remainder of the line containing the magic is ignored:
+		if lnum == 1 {
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		} else if trimmed == "." {
+			break
+		} else if trimmed[0] == '#' {
+			f.Comments = append(f.Comments, strings.TrimSpace(trimmed[1:]))
+			continue
+		}
+
+		idx := strings.IndexByte(line, '=')
+		if idx < 0 {
+			return nil, fmt.Errorf("caps: line %d: expected key=value, found %q", lnum, line)
+		}
+		key := strings.TrimSpace(line[:idx])
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("caps: line %d: invalid key %q", lnum, key)
+		}
+		f.Set(key, strings.TrimSpace(line[idx+1:]))
+	}
+
+	if err := scn.Err(); err != nil {
+		return nil, fmt.Errorf("caps: read failed: %w", err)
+	}
+	return f, nil
+}
+
+// Set the value for key, replacing any existing value.
+func (f *File) Set(key, value string) {
+	if f.index == nil {
+		f.index = map[string]int{}
+	}
+	lkey := strings.ToLower(key)
+	if idx, ok := f.index[lkey]; ok {
+		f.Pairs[idx].Value = value
+		return
+	}
+	f.index[lkey] = len(f.Pairs)
+	f.Pairs = append(f.Pairs, Pair{Key: key, Value: value})
+}
+
+func (f *File) Get(key string) (value string, ok bool) {
+	idx, ok := f.index[strings.ToLower(key)]
+	if !ok {
+		return "", false
+	}
+	return f.Pairs[idx].Value, true
+}
+
+// Bool returns the value for key as a bool. Values are case insensitive; 'TRUE', 'YES'
+// and '1' are true, 'FALSE', 'NO' and '0' are false.
+func (f *File) Bool(key string) (v bool, ok bool, err error) {
+	s, ok := f.Get(key)
+	if !ok {
+		return false, false, nil
+	}
+	v, err = parseBool(key, s)
+	return v, true, err
+}
+
+func parseBool(key, s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "1":
+		return true, nil
+	case "false", "no", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("caps: key %q has invalid bool value %q", key, s)
+}
+
+func (f *File) Int(key string) (v int, ok bool, err error) {
+	s, ok := f.Get(key)
+	if !ok {
+		return 0, false, nil
+	}
+	v, err = strconv.Atoi(s)
+	if err != nil {
+		return 0, true, fmt.Errorf("caps: key %q has invalid int value %q", key, s)
+	}
+	return v, true, nil
+}
+
+func (f *File) Version() int {
+	v, ok, err := f.Int(KeyVersion)
+	if !ok || err != nil {
+		return gopher.DefaultCaps.Version()
+	}
+	return v
+}
+
+// ExpiresAfter returns the value of ExpireCapsAfter, or -1 if it is missing or invalid.
+func (f *File) ExpiresAfter() time.Duration {
+	v, ok, err := f.Int(KeyExpireAfter)
+	if !ok || err != nil || v < 0 {
+		return -1
+	}
+	return time.Duration(v) * time.Second
+}
+
+func (f *File) Supports(feature gopher.Feature) gopher.FeatureStatus {
+	var key string
+	switch feature {
+	case gopher.FeatureII:
+		key = KeySupportsII
+	case gopher.FeatureIIbis:
+		key = KeySupportsIIbis
+	case gopher.FeaturePlusAsk:
+		key = KeySupportsPlusAsk
+	default:
+		return gopher.FeatureStatusUnknown
+	}
+
+	v, ok, err := f.Bool(key)
+	if !ok || err != nil {
+		return gopher.FeatureStatusUnknown
+	} else if v {
+		return gopher.FeatureSupported
+	}
+	return gopher.FeatureUnsupported
+}
+
+// lookupPath finds a Path* key. The spec spells 'delimiter' as 'delimeter', which most
+// servers copy, but we accept either spelling.
+func (f *File) lookupPath(key string) (string, bool) {
+	if v, ok := f.Get(key); ok {
+		return v, true
+	}
+	if strings.Contains(key, "Delimeter") {
+		return f.Get(strings.Replace(key, "Delimeter", "Delimiter", 1))
+	}
+	return "", false
+}
+
+// PathConfig returns the Path* keys as a gopher.PathConfig. Missing keys take their
+// value from gopher.UnixPathConfig, except for PathDelimeter: the spec says selectors
+// are opaque if it is missing, so the Delimiter is left empty. If any of the keys are
+// invalid, the config is returned along with an error describing the invalid keys, and
+// the invalid keys are left at their default.
+func (f *File) PathConfig() (*gopher.PathConfig, error) {
+	pc := gopher.UnixPathConfig
+	pc.Delimiter = ""
+	var errs []string
+
+	if v, ok := f.lookupPath(KeyPathDelimiter); ok {
+		pc.Delimiter = v
+	}
+	if v, ok := f.lookupPath(KeyPathIdentity); ok {
+		pc.Identity = v
+	}
+	if v, ok := f.lookupPath(KeyPathParent); ok {
+		pc.Parent = v
+	}
+	if v, ok := f.lookupPath(KeyPathEscape); ok {
+		if len(v) != 1 {
+			errs = append(errs, fmt.Sprintf("%s %q must be a single character", KeyPathEscape, v))
+		} else {
+			pc.EscapeCharacter = v[0]
+		}
+	}
+
+	for _, b := range []struct {
+		key string
+		dst *bool
+	}{
+		{KeyPathParentDouble, &pc.ParentDouble},
+		{KeyPathKeepPreDelim, &pc.KeepPreDelimiter},
+	} {
+		v, ok := f.lookupPath(b.key)
+		if !ok {
+			continue
+		}
+		if bv, err := parseBool(b.key, v); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			*b.dst = bv
+		}
+	}
+
+	if len(errs) > 0 {
+		return &pc, fmt.Errorf("caps: invalid path config: %s", strings.Join(errs, ", "))
+	}
+	return &pc, nil
+}
+
+func (f *File) ServerInfo() (*gopher.ServerInfo, error) {
+	var si gopher.ServerInfo
+	si.Software, _ = f.Get(KeyServerSoftware)
+	si.Version, _ = f.Get(KeyServerVersion)
+	si.Architecture, _ = f.Get(KeyServerArchitecture)
+	si.Description, _ = f.Get(KeyServerDescription)
+	si.Geolocation, _ = f.Get(KeyServerGeolocation)
+	si.AdminEmail, _ = f.Get(KeyServerAdmin)
+	return &si, nil
+}
+
+func (f *File) Software() (name, version string) {
+	name, _ = f.Get(KeyServerSoftware)
+	version, _ = f.Get(KeyServerVersion)
+	return name, version
+}
+
+// TLSPort returns the value of ServerTLSPort, or 0 if it is missing or invalid.
+func (f *File) TLSPort() int {
+	v, ok, err := f.Int(KeyServerTLSPort)
+	if !ok || err != nil || v <= 0 || v > 65535 {
+		return 0
+	}
+	return v
+}
+
+func (f *File) DefaultEncoding() string {
+	v, _ := f.Get(KeyDefaultEncoding)
+	return v
+}
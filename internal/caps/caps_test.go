@@ -0,0 +1,114 @@
+package caps
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+func TestParseDocCaps(t *testing.T) {
+	f, err := os.Open("../../doc/caps.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	caps, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := caps.Version(); v != 1 {
+		t.Fatal("version", v)
+	}
+	if v := caps.ExpiresAfter(); v != time.Hour {
+		t.Fatal("expires", v)
+	}
+	if v := caps.TLSPort(); v != 7443 {
+		t.Fatal("tls port", v)
+	}
+	if name, version := caps.Software(); name != "Bucktooth" || version != "0.2.9" {
+		t.Fatal("software", name, version)
+	}
+
+	pc, err := caps.PathConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *pc != gopher.UnixPathConfig {
+		t.Fatalf("path config %+v", pc)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for idx, tc := range []struct {
+		in  string
+		ok  bool
+		key string
+		val string
+	}{
+		{"CAPS\nfoo=bar\n", true, "foo", "bar"},
+		{"CAPS\r\nfoo = bar \r\n", true, "FOO", "bar"},
+		{"CAPS\nfoo=bar\nfoo=baz\n", true, "foo", "baz"},
+		{"CAPS\nfoo=a=b\n", true, "foo", "a=b"},
+		{"CAPS\nfoo=bar\n.\r\nbaz\n", true, "foo", "bar"},
+		{"CAPS\n# foo=bar\n", true, "foo", ""},
+		{"3Not found\t\terror.host\t1\r\n", false, "", ""},
+		{"CAPS\nfoo\n", false, "", ""},
+		{"CAPS\n=bar\n", false, "", ""},
+	} {
+		t.Run("", func(t *testing.T) {
+			caps, err := Parse(strings.NewReader(tc.in))
+			if !tc.ok {
+				if err == nil {
+					t.Fatal(idx, "expected error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(idx, err)
+			}
+			if v, _ := caps.Get(tc.key); v != tc.val {
+				t.Fatal(idx, v, "!=", tc.val)
+			}
+		})
+	}
+}
+
+func TestCrumbs(t *testing.T) {
+	mac := gopher.PathConfig{Delimiter: ":", Identity: ".", Parent: "..", ParentDouble: true, KeepPreDelimiter: true}
+	keep := gopher.UnixPathConfig
+	keep.KeepPreDelimiter = true
+	opaque := gopher.UnixPathConfig
+	opaque.Delimiter = ""
+
+	for idx, tc := range []struct {
+		pc   gopher.PathConfig
+		in   string
+		sels []string
+	}{
+		{gopher.UnixPathConfig, "", []string{""}},
+		{gopher.UnixPathConfig, "/", []string{""}},
+		{gopher.UnixPathConfig, "/a/b", []string{"", "/a", "/a/b"}},
+		{gopher.UnixPathConfig, "/a/b/", []string{"", "/a", "/a/b"}},
+		{gopher.UnixPathConfig, "/a//b", []string{"", "/a", "/a/b"}},
+		{gopher.UnixPathConfig, "1/a/b", []string{"", "/a", "/a/b"}},
+		{gopher.UnixPathConfig, "/a/./b/../c", []string{"", "/a", "/a/c"}},
+		{gopher.UnixPathConfig, `/a\/b/c`, []string{"", `/a\/b`, `/a\/b/c`}},
+		{keep, "a/b", []string{"", "a", "a/b"}},
+		{mac, "MacHD:x:y:::z", []string{"", "MacHD", "MacHD:z"}},
+		{opaque, "/a/b", []string{"", "/a/b"}},
+	} {
+		t.Run("", func(t *testing.T) {
+			var sels []string
+			for _, c := range Crumbs(&tc.pc, tc.in) {
+				sels = append(sels, c.Selector)
+			}
+			if strings.Join(sels, "|") != strings.Join(tc.sels, "|") {
+				t.Fatal(idx, tc.in, sels, "!=", tc.sels)
+			}
+		})
+	}
+}
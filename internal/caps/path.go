@@ -0,0 +1,135 @@
+package caps
+
+import (
+	"strings"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// Crumb is one level of a breadcrumb trail through a selector.
+type Crumb struct {
+	// Name of the segment, with escape characters removed. The root crumb's name is
+	// empty.
+	Name string
+
+	// Selector for the menu at this level.
+	Selector string
+}
+
+type segment struct {
+	raw  string // As it appeared in the selector
+	name string // With escapes removed
+}
+
+// Crumbs splits sel into a breadcrumb trail using the path rules in pc, starting with
+// the root, which always has an empty selector, and ending with sel itself (after
+// Identity and Parent segments have been resolved).
+//
+// If pc has no Delimiter, the selector is opaque and the trail is just the root
+// followed by sel.
+//
+// Unless pc.KeepPreDelimiter is set, anything before the first delimiter is
+// discarded, so '1/foo' and '/foo' produce the same trail.
+func Crumbs(pc *gopher.PathConfig, sel string) []Crumb {
+	root := Crumb{}
+	if sel == "" {
+		return []Crumb{root}
+	}
+	if pc.Delimiter == "" {
+		return []Crumb{root, {Name: sel, Selector: sel}}
+	}
+
+	segs, lead := splitPath(pc, sel)
+
+	var stack []segment
+	last := len(segs) - 1
+	for i, seg := range segs {
+		switch {
+		case seg.raw == "":
+			// Empty segments come from consecutive delimiters. A trailing delimiter is
+			// ignored, so 'x/y/' is the same as 'x/y'.
+			if pc.ParentDouble && i > 0 && i < last && len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case seg.raw == pc.Identity:
+		case seg.raw == pc.Parent:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		default:
+			stack = append(stack, seg)
+		}
+	}
+
+	crumbs := make([]Crumb, 0, len(stack)+1)
+	crumbs = append(crumbs, root)
+
+	var buf strings.Builder
+	buf.WriteString(lead)
+	for i, seg := range stack {
+		if i > 0 {
+			buf.WriteString(pc.Delimiter)
+		}
+		buf.WriteString(seg.raw)
+		crumbs = append(crumbs, Crumb{Name: seg.name, Selector: buf.String()})
+	}
+	return crumbs
+}
+
+// Parent returns the selector of the menu above sel. ok is false if sel is the root.
+func Parent(pc *gopher.PathConfig, sel string) (parent string, ok bool) {
+	crumbs := Crumbs(pc, sel)
+	if len(crumbs) < 2 {
+		return "", false
+	}
+	return crumbs[len(crumbs)-2].Selector, true
+}
+
+// splitPath splits sel on unescaped delimiters. lead is the delimiter if sel started
+// with one after the pre-delimiter part was discarded.
+func splitPath(pc *gopher.PathConfig, sel string) (segs []segment, lead string) {
+	delim, esc := pc.Delimiter, pc.EscapeCharacter
+
+	var raw, name strings.Builder
+	var escaped bool
+	var hasPre bool
+
+	for i := 0; i < len(sel); {
+		if escaped {
+			raw.WriteByte(sel[i])
+			name.WriteByte(sel[i])
+			escaped = false
+			i++
+
+		} else if esc != 0 && sel[i] == esc {
+			raw.WriteByte(sel[i])
+			escaped = true
+			i++
+
+		} else if strings.HasPrefix(sel[i:], delim) {
+			if len(segs) == 0 && !hasPre && !pc.KeepPreDelimiter {
+				// Discard anything before the first delimiter:
+				raw.Reset()
+				name.Reset()
+				hasPre = true
+				lead = delim
+			} else if len(segs) == 0 && raw.Len() == 0 && i == 0 {
+				hasPre = true
+				lead = delim
+			} else {
+				segs = append(segs, segment{raw: raw.String(), name: name.String()})
+				raw.Reset()
+				name.Reset()
+			}
+			i += len(delim)
+
+		} else {
+			raw.WriteByte(sel[i])
+			name.WriteByte(sel[i])
+			i++
+		}
+	}
+
+	segs = append(segs, segment{raw: raw.String(), name: name.String()})
+	return segs, lead
+}
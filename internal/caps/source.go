@@ -0,0 +1,201 @@
+package caps
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shabbyrobe/fur/internal/cache"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// DefaultExpiry is used when a caps file doesn't contain ExpireCapsAfter, and for
+// servers that don't have a caps file at all.
+const DefaultExpiry = 24 * time.Hour
+
+// URL returns the URL of the caps file for the server at host and port.
+func URL(host, port string) gopher.URL {
+	if port == "" {
+		port = "70"
+	}
+	return gopher.URL{
+		Scheme:   "gopher",
+		Hostname: host,
+		Port:     port,
+		ItemType: gopher.Text,
+		Selector: Selector,
+	}
+}
+
+// Fetch and parse the caps file for the server at host and port. The raw response is
+// returned along with the parsed caps so that it can be stored.
+//
+// client must not use a CapsSource that calls Fetch with the same client, or Fetch
+// will recurse until the stack runs out.
+func Fetch(ctx context.Context, client *gopher.Client, host, port string) (*File, []byte, error) {
+	data, err := fetchRaw(ctx, client, host, port)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := ParseBytes(data)
+	return f, data, err
+}
+
+func fetchRaw(ctx context.Context, client *gopher.Client, host, port string) ([]byte, error) {
+	rq := gopher.NewRequest(URL(host, port), nil)
+	rs, err := client.Raw(ctx, rq)
+	if err != nil {
+		return nil, fmt.Errorf("caps: fetch from %s failed: %w", net.JoinHostPort(host, port), err)
+	}
+	defer rs.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(rs.Reader(), MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("caps: fetch from %s failed: %w", net.JoinHostPort(host, port), err)
+	}
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("caps: file larger than %d bytes", MaxSize)
+	}
+	return data, nil
+}
+
+// Source is a gopher.CapsSource that fetches caps files using Client, and caches them
+// in memory and, if Cache is set, on disk. Caps are kept for as long as the server's
+// ExpireCapsAfter, or DefaultExpiry if it isn't set.
+//
+// Caps files are optional, so servers that don't have one, or have one that can't be
+// parsed, are not an error; they are remembered for DefaultExpiry and LoadCaps returns
+// nil, which the client treats as gopher.DefaultCaps. Network errors are returned as-is
+// and are not cached.
+type Source struct {
+	// Client must not use this Source as its CapsSource. Copy the client used for
+	// regular requests and clear its CapsSource.
+	Client *gopher.Client
+
+	// ClientFor, if set, returns the client to fetch the caps file at u with, given
+	// Client. It can be used to configure the client per host, such as to check pinned
+	// certificates.
+	ClientFor func(client *gopher.Client, u gopher.URL) *gopher.Client
+
+	// Cache should have no TTL; expiry is calculated from the caps file itself. Entries
+	// for servers without caps files are stored empty.
+	Cache *cache.Cache
+
+	now    func() time.Time
+	mu     sync.Mutex
+	loaded map[string]loadedCaps
+}
+
+var _ gopher.CapsSource = &Source{}
+
+type loadedCaps struct {
+	caps    *File
+	expires time.Time
+}
+
+func NewSource(client *gopher.Client, cache *cache.Cache) *Source {
+	return &Source{
+		Client: client,
+		Cache:  cache,
+		now:    time.Now,
+		loaded: map[string]loadedCaps{},
+	}
+}
+
+func (src *Source) LoadCaps(ctx context.Context, host, port string) (gopher.Caps, error) {
+	caps, err := src.Load(ctx, host, port, false)
+	if caps == nil || err != nil {
+		// Careful: returning a nil *File would result in a non-nil gopher.Caps.
+		return nil, err
+	}
+	return caps, nil
+}
+
+// Load the caps for the server at host and port. If the server doesn't have a valid
+// caps file, Load returns nil, nil. If refresh is true, the caps are fetched even if
+// they are cached.
+func (src *Source) Load(ctx context.Context, host, port string, refresh bool) (*File, error) {
+	if port == "" {
+		port = "70"
+	}
+	key := strings.ToLower(host) + ":" + port
+	now := src.now()
+
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	if !refresh {
+		if lc, ok := src.loaded[key]; ok && now.Before(lc.expires) {
+			return lc.caps, nil
+		}
+		if lc, ok := src.loadCached(host, port, now); ok {
+			src.loaded[key] = lc
+			return lc.caps, nil
+		}
+	}
+
+	client := src.Client
+	if src.ClientFor != nil {
+		client = src.ClientFor(client, URL(host, port))
+	}
+	data, err := fetchRaw(ctx, client, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := ParseBytes(data)
+	if err != nil {
+		// The server responded, but not with a caps file:
+		f, data = nil, nil
+	}
+
+	lc := loadedCaps{caps: f, expires: now.Add(expiry(f))}
+	src.loaded[key] = lc
+
+	// The caps are still usable if they can't be stored, so the error is discarded; the
+	// worst that can happen is that they are fetched again next time:
+	if src.Cache != nil {
+		_ = src.Cache.Put(URL(host, port), now, data)
+	}
+	return f, nil
+}
+
+// loadCached loads caps from the disk cache. Unreadable or corrupt entries are treated
+// as missing so they get replaced.
+func (src *Source) loadCached(host, port string, now time.Time) (lc loadedCaps, ok bool) {
+	if src.Cache == nil {
+		return lc, false
+	}
+	data, at, ok, err := src.Cache.Get(URL(host, port), now)
+	if err != nil || !ok {
+		return lc, false
+	}
+
+	var f *File
+	if len(data) > 0 {
+		if f, err = ParseBytes(data); err != nil {
+			return lc, false
+		}
+	}
+
+	lc = loadedCaps{caps: f, expires: at.Add(expiry(f))}
+	if !now.Before(lc.expires) {
+		return lc, false
+	}
+	return lc, true
+}
+
+func expiry(f *File) time.Duration {
+	if f == nil {
+		return DefaultExpiry
+	}
+	if exp := f.ExpiresAfter(); exp >= 0 {
+		return exp
+	}
+	return DefaultExpiry
+}
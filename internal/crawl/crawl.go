@@ -0,0 +1,377 @@
+// Package crawl fetches everything reachable from a set of gopher URLs, breadth-first.
+package crawl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/shabbyrobe/fur/internal/cache"
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/fur/internal/robots"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// ErrRobots is the Result.Err for URLs that the server's robots.txt asks crawlers not
+// to fetch.
+var ErrRobots = errors.New("crawl: disallowed by robots.txt")
+
+// Item is a URL waiting to be fetched.
+type Item struct {
+	URL gopher.URL `json:"url"`
+
+	// Number of links followed from a start URL to find this one.
+	Depth int `json:"depth"`
+
+	// Menu the URL was found in, or nil for a start URL.
+	Parent *gopher.URL `json:"parent,omitempty"`
+}
+
+// Result of fetching an Item.
+type Result struct {
+	Item
+
+	// Entry is the response as it would be recorded in a furball, which is nil if the
+	// request couldn't be sent. Errors reported by the server are in Entry.Status.
+	Entry *furball.Entry
+
+	// Err is any error fetching the URL, including errors reported by the server. If
+	// the URL wasn't fetched because of robots.txt, Err is ErrRobots.
+	Err error
+
+	// Links found in a menu, before they are filtered by Crawler.Follow.
+	Links []gopher.URL
+}
+
+type Crawler struct {
+	// Client used to fetch URLs. Crawler replaces the client's Recorder.
+	Client *gopher.Client
+
+	// Number of URLs to fetch at once. Defaults to 1.
+	Workers int
+
+	// Links are not followed from menus at this depth; 0 only fetches the start URLs.
+	MaxDepth int
+
+	// Stop after fetching this many URLs. 0 is unlimited.
+	Limit int
+
+	// Minimum time between starting requests to the same host. A longer Crawl-delay
+	// in the host's robots.txt takes precedence.
+	Delay time.Duration
+
+	// Stop reading responses that aren't menus after this many bytes, and discard the
+	// rest, so the Entry only holds the start of the response. 0 reads everything.
+	MaxRead int64
+
+	// Robots, if set, is consulted before each URL is fetched. Anything that bulk
+	// fetches from other people's servers should set it.
+	Robots *robots.Source
+
+	// Follow, if set, reports whether a link should be fetched. Start URLs are always
+	// fetched.
+	Follow func(u gopher.URL, parent *Item) bool
+
+	// Visit, if set, is called with the result of each fetch, one at a time, in the
+	// order they complete. If Visit returns an error, the crawl stops.
+	Visit func(rs *Result) error
+
+	// State, if set, records the progress of the crawl so it can be resumed.
+	State *State
+
+	// ClientFor, if set, returns the client to fetch u with, given Client. It can be
+	// used to configure the client per host, such as to check pinned certificates.
+	ClientFor func(client *gopher.Client, u gopher.URL) *gopher.Client
+
+	mu      sync.Mutex
+	entries map[*gopher.Request]*furball.Entry
+	nextAt  map[string]time.Time
+}
+
+// Key is the form of u used to decide whether it has already been crawled.
+func Key(u gopher.URL) string {
+	return cache.Normalize(u).String()
+}
+
+// Crawl fetches the start URLs and everything that can be reached from them, one depth
+// at a time. If the crawl is resumed from State, start URLs that have already been
+// crawled are not fetched again.
+func (c *Crawler) Crawl(ctx context.Context, start ...gopher.URL) error {
+	c.entries = make(map[*gopher.Request]*furball.Entry)
+	c.nextAt = make(map[string]time.Time)
+	c.Client.Recorder = furball.RecorderFunc(c.record)
+
+	seen := make(map[string]bool)
+	var queue []Item
+	if c.State != nil {
+		for key := range c.State.seen {
+			seen[key] = true
+		}
+		queue = c.State.Pending()
+	}
+
+	enqueue := func(it Item) error {
+		key := Key(it.URL)
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+		queue = append(queue, it)
+		if c.State != nil {
+			return c.State.queued(it)
+		}
+		return nil
+	}
+
+	for _, u := range start {
+		if err := enqueue(Item{URL: u}); err != nil {
+			return err
+		}
+	}
+
+	fetched := 0
+	for len(queue) > 0 {
+		// Every item at the shallowest depth is fetched before any links found in them,
+		// so the crawl is breadth-first:
+		n := 1
+		for n < len(queue) && queue[n].Depth == queue[0].Depth {
+			n++
+		}
+		if c.Limit > 0 && fetched+n > c.Limit {
+			n = c.Limit - fetched
+		}
+		if n <= 0 {
+			break
+		}
+		batch := queue[:n]
+		queue = queue[n:]
+		fetched += n
+
+		err := c.fetchAll(ctx, batch, func(rs *Result) error {
+			if c.Visit != nil {
+				if err := c.Visit(rs); err != nil {
+					return err
+				}
+			}
+			if rs.Depth < c.MaxDepth {
+				for _, link := range rs.Links {
+					if c.Follow != nil && !c.Follow(link, &rs.Item) {
+						continue
+					}
+					parent := rs.URL
+					if err := enqueue(Item{URL: link, Depth: rs.Depth + 1, Parent: &parent}); err != nil {
+						return err
+					}
+				}
+			}
+
+			// The links must be queued before the menu is done, or they would be lost if
+			// the crawl stopped in between:
+			if c.State != nil {
+				return c.State.done(rs.URL)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchAll fetches every item in batch using the workers, calling visit with each result
+// from the calling goroutine. Items that fail because ctx is done are not visited, so
+// they are fetched again if the crawl is resumed.
+func (c *Crawler) fetchAll(ctx context.Context, batch []Item, visit func(rs *Result) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := c.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(batch) {
+		workers = len(batch)
+	}
+
+	items := make(chan Item)
+	results := make(chan *Result)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range items {
+				results <- c.fetch(ctx, it)
+			}
+		}()
+	}
+	go func() {
+		defer close(items)
+		for _, it := range batch {
+			select {
+			case items <- it:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var verr error
+	for rs := range results {
+		if verr != nil || ctx.Err() != nil {
+			continue
+		}
+		if verr = visit(rs); verr != nil {
+			cancel()
+		}
+	}
+	if verr != nil {
+		return verr
+	}
+	return ctx.Err()
+}
+
+func (c *Crawler) fetch(ctx context.Context, it Item) *Result {
+	rs := &Result{Item: it}
+
+	delay := c.Delay
+	if c.Robots != nil {
+		rules, err := c.Robots.Load(ctx, it.URL.Hostname, it.URL.Port)
+		if err != nil {
+			rs.Err = err
+			return rs
+		}
+		if !rules.Allowed(it.URL.Selector) {
+			rs.Err = ErrRobots
+			return rs
+		}
+		if rules.Delay > delay {
+			delay = rules.Delay
+		}
+	}
+
+	if err := c.wait(ctx, it.URL.Host(), delay); err != nil {
+		rs.Err = err
+		return rs
+	}
+
+	client := c.Client
+	if c.ClientFor != nil {
+		client = c.ClientFor(client, it.URL)
+	}
+	rq := gopher.NewRequest(it.URL, nil)
+	rsp, err := client.Fetch(ctx, rq)
+	if err == nil {
+		if c.MaxRead > 0 && !IsMenu(it.URL) {
+			_, err = io.CopyN(ioutil.Discard, rsp.Reader(), c.MaxRead)
+			if err == io.EOF {
+				err = nil
+			}
+		} else {
+			_, err = io.Copy(ioutil.Discard, rsp.Reader())
+		}
+		if cerr := rsp.Close(); err == nil {
+			err = cerr
+		}
+	}
+	rs.Err = err
+
+	c.mu.Lock()
+	rs.Entry = c.entries[rq]
+	delete(c.entries, rq)
+	c.mu.Unlock()
+
+	var gopherErr *gopher.Error
+	if rs.Entry != nil && err != nil && !errors.As(err, &gopherErr) && rs.Entry.Status == gopher.OK {
+		// The server didn't report this error, but the entry shouldn't look like a
+		// success:
+		rs.Entry.Status, rs.Entry.Msg = gopher.StatusGeneralError, err.Error()
+	}
+
+	if err == nil && rs.Entry != nil && IsMenu(it.URL) {
+		rs.Links, rs.Err = Links(it.URL, rs.Entry.Out)
+	}
+	return rs
+}
+
+// record keeps the last entry recorded for each request; there may be more than one if
+// the client retries without TLS.
+func (c *Crawler) record(rq *gopher.Request, e furball.Entry) {
+	c.mu.Lock()
+	c.entries[rq] = &e
+	c.mu.Unlock()
+}
+
+// wait blocks until a request can be sent to host without breaking the delay between
+// requests.
+func (c *Crawler) wait(ctx context.Context, host string, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	at := c.nextAt[host]
+	if at.Before(now) {
+		at = now
+	}
+	c.nextAt[host] = at.Add(delay)
+	c.mu.Unlock()
+
+	if wait := at.Sub(now); wait > 0 {
+		tm := time.NewTimer(wait)
+		defer tm.Stop()
+		select {
+		case <-tm.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// IsMenu reports whether the response for u is a menu that links can be found in.
+// Search results are menus, but searches can't be crawled without a query.
+func IsMenu(u gopher.URL) bool {
+	return u.Root || u.ItemType == gopher.Dir
+}
+
+// Links returns the URLs in a menu that can be fetched. Links with no host are taken to
+// be on the same server as the menu.
+func Links(menu gopher.URL, data []byte) ([]gopher.URL, error) {
+	rdr := gopher.NewDirReader(bytes.NewReader(data))
+	rdr.Flag = gopher.DirentHostOptional
+
+	var links []gopher.URL
+	var dirent gopher.Dirent
+	for rdr.Read(&dirent) {
+		if dirent.ItemType == gopher.Info || dirent.ItemType == gopher.ItemError {
+			continue
+		}
+		if _, ok := dirent.WWW(); ok {
+			continue
+		}
+		u := dirent.URL()
+		if u.Hostname == "" {
+			u.Hostname, u.Port = menu.Hostname, menu.Port
+		}
+		if !u.CanFetch() || u.ItemType.IsSearch() {
+			continue
+		}
+		links = append(links, u)
+	}
+	if err := rdr.ReadErr(); err != nil {
+		return links, fmt.Errorf("crawl: invalid menu %s: %w", menu, err)
+	}
+	return links, nil
+}
@@ -0,0 +1,156 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/fur/internal/robots"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+func serveHole(t *testing.T) (host, port string, close func()) {
+	// furlib rejects ports in menus above 32767, which rules out ephemeral ports:
+	var ln net.Listener
+	var err error
+	for i := 0; ln == nil; i++ {
+		ln, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", 20000+rand.Intn(10000)))
+		if err != nil && i > 100 {
+			t.Fatal(err)
+		}
+	}
+	host, port, _ = net.SplitHostPort(ln.Addr().String())
+	link := func(it byte, sel string) string {
+		return string(it) + sel + "\t" + sel + "\t" + host + "\t" + port + "\r\n"
+	}
+
+	ball := &furball.Ball{Entries: []furball.Entry{
+		{In: []byte("/\r\n"), Out: []byte("iHello\t\terror.invalid\t0\r\n" +
+			link('1', "/a") + link('0', "/doc") + "1Elsewhere\t/\texample.com\t70\r\n.\r\n")},
+		{In: []byte("/a\r\n"), Out: []byte(link('1', "/") + link('0', "/a/deep") + link('1', "/b") + ".\r\n")},
+		{In: []byte("/b\r\n"), Out: []byte(link('0', "/b/c") + ".\r\n")},
+		{In: []byte("/doc\r\n"), Out: []byte("doc\r\n.\r\n")},
+		{In: []byte("/a/deep\r\n"), Out: []byte("deep\r\n.\r\n")},
+		{In: []byte("/b/c\r\n"), Out: []byte("c\r\n.\r\n")},
+		{In: []byte("robots.txt\r\n"), Out: []byte("User-agent: *\r\nDisallow: /a/\r\nDisallow: /doc\r\n.\r\n")},
+	}}
+
+	srv := &gopher.Server{Handler: furball.NewHandler(ball)}
+	go srv.Serve(ln, "")
+	return host, port, func() { srv.Close() }
+}
+
+func TestCrawl(t *testing.T) {
+	host, port, done := serveHole(t)
+	defer done()
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	statePath := filepath.Join(tmp, "crawl.state")
+
+	start := gopher.URL{Scheme: "gopher", Hostname: host, Port: port, ItemType: gopher.Dir, Selector: "/"}
+
+	var visited []string
+	crawl := func(limit int) {
+		state, err := OpenState(statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer state.Close()
+
+		lastDepth := -1
+		c := &Crawler{
+			Client:   &gopher.Client{TLSMode: gopher.TLSDisabled},
+			Workers:  2,
+			MaxDepth: 2,
+			Limit:    limit,
+			State:    state,
+			Follow: func(u gopher.URL, parent *Item) bool {
+				return u.Hostname == host
+			},
+			Visit: func(rs *Result) error {
+				if rs.Err != nil {
+					t.Fatal(rs.URL, rs.Err)
+				}
+				if rs.Depth < lastDepth {
+					t.Fatal("not breadth first:", rs.URL, rs.Depth, "after", lastDepth)
+				}
+				lastDepth = rs.Depth
+				visited = append(visited, rs.URL.Selector)
+				return nil
+			},
+		}
+		if err := c.Crawl(context.Background(), start); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	crawl(2)
+	if len(visited) != 2 {
+		t.Fatal(visited)
+	}
+
+	// Resuming fetches the rest, but doesn't refetch anything:
+	crawl(0)
+	sort.Strings(visited)
+	if result := strings.Join(visited, " "); result != "/ /a /a/deep /b /doc" {
+		t.Fatal(result)
+	}
+
+	crawl(0)
+	if len(visited) != 5 {
+		t.Fatal(visited)
+	}
+}
+
+func TestCrawlRobots(t *testing.T) {
+	host, port, done := serveHole(t)
+	defer done()
+
+	client := &gopher.Client{TLSMode: gopher.TLSDisabled}
+	robotsClient := *client
+
+	var visited, skipped []string
+	c := &Crawler{
+		Client:   client,
+		MaxDepth: 2,
+		Robots:   robots.NewSource(&robotsClient),
+		Follow: func(u gopher.URL, parent *Item) bool {
+			return u.Hostname == host
+		},
+		Visit: func(rs *Result) error {
+			if rs.Err == ErrRobots {
+				skipped = append(skipped, rs.URL.Selector)
+			} else if rs.Err != nil {
+				t.Fatal(rs.URL, rs.Err)
+			} else {
+				visited = append(visited, rs.URL.Selector)
+			}
+			return nil
+		},
+	}
+	start := gopher.URL{Scheme: "gopher", Hostname: host, Port: port, ItemType: gopher.Dir, Selector: "/"}
+	if err := c.Crawl(context.Background(), start); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(visited)
+	sort.Strings(skipped)
+	if result := strings.Join(visited, " "); result != "/ /a /b" {
+		t.Fatal(result)
+	}
+	if result := strings.Join(skipped, " "); result != "/a/deep /doc" {
+		t.Fatal(result)
+	}
+}
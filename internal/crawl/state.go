@@ -0,0 +1,131 @@
+package crawl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// State records the progress of a crawl in a file, so that it can be resumed if it is
+// interrupted. The file is append-only; each line is either an Item that was queued, or
+// a URL that was crawled:
+//
+//	{"url":"gopher://example.com/1/","depth":0}
+//	{"url":"gopher://example.com/1/","done":true}
+//
+// Once a crawl has finished, resuming it does nothing. Remove the file to crawl again.
+type State struct {
+	file    *os.File
+	enc     *json.Encoder
+	seen    map[string]bool
+	crawled map[string]bool
+	pending []Item
+}
+
+type stateLine struct {
+	Item
+	Done bool `json:"done,omitempty"`
+}
+
+type stateDone struct {
+	URL  gopher.URL `json:"url"`
+	Done bool       `json:"done"`
+}
+
+// OpenState opens the state file at path, creating it if it doesn't exist.
+func OpenState(path string) (*State, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("crawl: open state %q failed: %w", path, err)
+	}
+
+	s := &State{
+		file:    f,
+		enc:     json.NewEncoder(f),
+		seen:    make(map[string]bool),
+		crawled: make(map[string]bool),
+	}
+
+	var queued []Item
+	var cutOff bool
+	scn := bufio.NewScanner(f)
+	scn.Split(scanLines)
+	for scn.Scan() {
+		raw := scn.Bytes()
+		cutOff = raw[len(raw)-1] != '\n'
+		var line stateLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			// The last line may have been cut off if the crawl was killed while writing
+			// it; it is written again when the crawl is resumed:
+			continue
+		}
+		key := Key(line.URL)
+		if line.Done {
+			s.crawled[key] = true
+		} else if !s.seen[key] {
+			s.seen[key] = true
+			queued = append(queued, line.Item)
+		}
+	}
+	if err := scn.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("crawl: load state %q failed: %w", path, err)
+	}
+
+	// Don't append to a line that was cut off:
+	if cutOff {
+		if _, err := f.Write([]byte{'\n'}); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("crawl: load state %q failed: %w", path, err)
+		}
+	}
+
+	for _, it := range queued {
+		if !s.crawled[Key(it.URL)] {
+			s.pending = append(s.pending, it)
+		}
+	}
+	return s, nil
+}
+
+// Pending returns the items that were queued but not crawled, in the order they were
+// queued.
+func (s *State) Pending() []Item {
+	return append([]Item(nil), s.pending...)
+}
+
+func (s *State) queued(it Item) error {
+	s.seen[Key(it.URL)] = true
+	if err := s.enc.Encode(stateLine{Item: it}); err != nil {
+		return fmt.Errorf("crawl: save state failed: %w", err)
+	}
+	return nil
+}
+
+func (s *State) done(u gopher.URL) error {
+	s.crawled[Key(u)] = true
+	if err := s.enc.Encode(stateDone{URL: u, Done: true}); err != nil {
+		return fmt.Errorf("crawl: save state failed: %w", err)
+	}
+	return nil
+}
+
+// scanLines splits lines like bufio.ScanLines, but keeps the newline, so a line that was
+// cut off can be told apart from one that wasn't.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func (s *State) Close() error {
+	return s.file.Close()
+}
@@ -1,9 +1,12 @@
 package flatdump
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"strconv"
 	"time"
 
 	"github.com/shabbyrobe/furlib/gopher"
@@ -13,65 +16,175 @@ import (
 // tests here and there and from bash.
 //
 // Format:
+//
 //	FUR-DUMP <iso8601dt> <url>
 //	<response>...
 //
 // To dump from bash (wrecking all trailing newlines in the process):
+//
 //	url=...
 //	out=...
-//  echo -en "FUR-DUMP $( date -Is ) $url\n$out"
+//	echo -en "FUR-DUMP $( date -Is ) $url\n$out"
+//
+// Several responses can be dumped to the same stream by adding the length of each
+// response in bytes to its header. Each response is followed by a newline, so the
+// stream stays readable with 'less':
+//
+//	FUR-DUMP <iso8601dt> <url> <length>
+//	<response>
+//	FUR-DUMP <iso8601dt> <url> <length>
+//	<response>
+//
+// To dump from bash without wrecking anything:
 //
+//	{ printf 'FUR-DUMP %s %s %d\n' "$( date -Is )" "$url" "$( wc -c < out )"; cat out; echo; } >> dump
+//
+// A record without a length runs to the end of the stream, so it can only be last.
 type FlatDump struct {
 	At  time.Time
 	URL gopher.URL
 	io.Reader
 }
 
+// maxHeader is the longest header line that will be read.
+const maxHeader = 8192
+
+// ReadFlatDump reads the first record in rdr.
 func ReadFlatDump(rdr io.Reader) (*FlatDump, error) {
-	var buf = make([]byte, 8192)
+	return NewReader(rdr).Next()
+}
+
+// Reader reads the records in a stream one at a time.
+type Reader struct {
+	rdr  *bufio.Reader
+	cur  io.Reader
+	sep  bool
+	done bool
+}
+
+func NewReader(rdr io.Reader) *Reader {
+	return &Reader{rdr: bufio.NewReaderSize(rdr, maxHeader)}
+}
 
-	n, err := rdr.Read(buf)
-	if err != nil && (err != io.EOF || n == 0) {
+// Next returns the next record, or io.EOF if there are no more. Any part of the
+// previous record's response that hasn't been read is skipped.
+func (r *Reader) Next() (*FlatDump, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	if err := r.skip(); err != nil {
 		return nil, err
 	}
-	buf = buf[:n]
-	nl := bytes.IndexByte(buf, '\n')
-	if nl < 0 {
-		return nil, fmt.Errorf("furball: no newline found in first read")
+
+	line, err := r.rdr.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, fmt.Errorf("flatdump: header longer than %d bytes", maxHeader)
+	} else if err == io.EOF && len(line) == 0 {
+		r.done = true
+		return nil, io.EOF
+	} else if err == io.EOF {
+		return nil, fmt.Errorf("flatdump: no newline found after header")
+	} else if err != nil {
+		return nil, err
 	}
-	line, rest := buf[:nl], buf[nl+1:]
 
+	dump, length, err := parseHeader(bytes.TrimRight(line, "\r\n"))
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		r.cur = r.rdr
+		r.done = true
+	} else {
+		r.cur = io.LimitReader(r.rdr, length)
+		r.sep = true
+	}
+	dump.Reader = r.cur
+	return dump, nil
+}
+
+// skip discards the rest of the current record, and the newline that follows it.
+func (r *Reader) skip() error {
+	if r.cur == nil {
+		return nil
+	}
+	if _, err := io.Copy(ioutil.Discard, r.cur); err != nil {
+		return err
+	}
+	r.cur = nil
+
+	if r.sep {
+		r.sep = false
+		b, err := r.rdr.ReadByte()
+		if err == io.EOF {
+			r.done = true
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if b == '\r' {
+			b, err = r.rdr.ReadByte()
+		}
+		if err != nil || b != '\n' {
+			return fmt.Errorf("flatdump: expected newline after response")
+		}
+	}
+	return nil
+}
+
+// parseHeader parses a header line. length is -1 if the header doesn't have one.
+func parseHeader(line []byte) (dump *FlatDump, length int64, err error) {
 	if !bytes.HasPrefix(line, furDumpMagic) {
-		return nil, fmt.Errorf("furball: no magic found")
+		return nil, 0, fmt.Errorf("flatdump: no magic found")
 	}
 	line = bytes.TrimLeft(line[len(furDumpMagic):], " ")
 
 	dateEnd := bytes.IndexByte(line, ' ')
 	if dateEnd < 0 {
-		return nil, fmt.Errorf("furball: date not found")
+		return nil, 0, fmt.Errorf("flatdump: date not found")
 	}
 
 	tm, err := time.Parse(time.RFC3339, string(line[:dateEnd]))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	rest := line[dateEnd+1:]
+
+	// URLs written by fur are escaped, but ones written from bash may not be, so the
+	// length is only taken from the last field if it is a number:
+	length = -1
+	if lenStart := bytes.LastIndexByte(rest, ' '); lenStart >= 0 {
+		if n, err := strconv.ParseInt(string(rest[lenStart+1:]), 10, 64); err == nil && n >= 0 {
+			length = n
+			rest = rest[:lenStart]
+		}
 	}
 
-	url, err := gopher.ParseURL(string(bytes.TrimRight(line[dateEnd+1:], "\r")))
+	url, err := gopher.ParseURL(string(rest))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return &FlatDump{
-		At:     tm,
-		URL:    url,
-		Reader: io.MultiReader(bytes.NewReader(rest), rdr),
-	}, nil
+	return &FlatDump{At: tm, URL: url}, length, nil
 }
 
 func WriteFlatDumpHeader(w io.Writer, url gopher.URL, at time.Time) (n int, err error) {
 	return fmt.Fprintf(w, "FUR-DUMP %s %s\n", at.Format(time.RFC3339), url)
 }
 
+// WriteFlatDump writes a record with a length, which can be followed by other records
+// in the same stream.
+func WriteFlatDump(w io.Writer, url gopher.URL, at time.Time, data []byte) error {
+	if _, err := fmt.Fprintf(w, "FUR-DUMP %s %s %d\n", at.Format(time.RFC3339), url, len(data)); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{'\n'})
+	return err
+}
+
 var (
 	furDumpMagic = []byte("FUR-DUMP")
 )
@@ -0,0 +1,61 @@
+package flatdump
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+func TestReader(t *testing.T) {
+	at := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	u1, _ := gopher.ParseURL("gopher://localhost/0/one")
+	u2, _ := gopher.ParseURL("gopher://localhost/1/two words")
+
+	var buf bytes.Buffer
+	if err := WriteFlatDump(&buf, u1, at, []byte("first\r\nresponse\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFlatDump(&buf, u2, at, []byte{}); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("FUR-DUMP 2020-03-01T12:00:00Z gopher://localhost/0/three 3\r\nabc\r\n")
+
+	// A record without a length can be last:
+	buf.WriteString("FUR-DUMP 2020-03-01T12:00:00Z gopher://localhost/0/rest\nthe rest\n")
+
+	rdr := NewReader(&buf)
+	var urls, bodies []string
+	for i := 0; ; i++ {
+		dump, err := rdr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		urls = append(urls, dump.URL.Selector)
+		if !dump.At.Equal(at) {
+			t.Fatal(dump.At)
+		}
+
+		// The third record isn't read, to check that it's skipped:
+		if i != 2 {
+			body, err := ioutil.ReadAll(dump)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bodies = append(bodies, string(body))
+		}
+	}
+
+	if result := strings.Join(urls, "|"); result != "/one|/two words|/three|/rest" {
+		t.Fatal(result)
+	}
+	if result := strings.Join(bodies, "|"); result != "first\r\nresponse\n||the rest\n" {
+		t.Fatalf("%q", result)
+	}
+}
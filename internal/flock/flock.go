@@ -0,0 +1,60 @@
+// Package flock provides advisory locks that coordinate access to a file between
+// processes.
+//
+// Locks are taken on a separate lock file rather than the file itself, so the file can
+// be replaced by renaming over it while the lock is held. The lock file is left behind
+// after the lock is released, except where there is no flock(2), where the presence of
+// the lock file is the lock.
+package flock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Ext is appended to the path of the file being locked to get the lock file's path.
+const Ext = ".lock"
+
+// pollInterval is how often a held lock is retried. Locks are expected to be held for
+// as long as it takes to write a file, so this is short.
+const pollInterval = 5 * time.Millisecond
+
+type Lock struct {
+	path string
+	file *os.File
+}
+
+// Acquire takes the lock for the file at path, waiting until it is released by any
+// other holder or ctx is done.
+func Acquire(ctx context.Context, path string) (*Lock, error) {
+	lockPath := path + Ext
+
+	var ticker *time.Ticker
+	for {
+		f, ok, err := tryLock(lockPath)
+		if err != nil {
+			return nil, fmt.Errorf("flock: lock %q failed: %w", lockPath, err)
+		} else if ok {
+			return &Lock{path: lockPath, file: f}, nil
+		}
+
+		if ticker == nil {
+			ticker = time.NewTicker(pollInterval)
+			defer ticker.Stop()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("flock: lock %q failed: %w", lockPath, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *Lock) Release() error {
+	if err := unlock(l.path, l.file); err != nil {
+		return fmt.Errorf("flock: unlock %q failed: %w", l.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package flock
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// StaleAfter is how old a lock file has to be before it is presumed to have been left
+// behind by a process that died while holding it. Without flock(2), the lock isn't
+// released automatically when that happens.
+var StaleAfter = 1 * time.Minute
+
+func tryLock(path string) (f *os.File, ok bool, err error) {
+	f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if errors.Is(err, os.ErrExist) {
+		if info, serr := os.Stat(path); serr == nil && time.Since(info.ModTime()) > StaleAfter {
+			os.Remove(path)
+		}
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return f, true, nil
+}
+
+func unlock(path string, f *os.File) error {
+	err := f.Close()
+	if rerr := os.Remove(path); err == nil {
+		err = rerr
+	}
+	return err
+}
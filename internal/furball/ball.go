@@ -19,7 +19,31 @@ func (b *Ball) BeginRecording(rq *gopher.Request, at time.Time) gopher.Recording
 		return nil
 	}
 	return &EntryRecording{
-		ball: b,
+		add: b.add,
+		entry: Entry{
+			URL: rq.URL(),
+			At:  at,
+		},
+	}
+}
+
+func (b *Ball) add(e Entry) {
+	b.Entries = append(b.Entries, e)
+}
+
+// RecorderFunc is a gopher.Recorder that calls fn with each entry as soon as its
+// recording is done, along with the request it was recorded for. fn may be called from
+// several goroutines at once.
+type RecorderFunc func(rq *gopher.Request, e Entry)
+
+var _ gopher.Recorder = RecorderFunc(nil)
+
+func (fn RecorderFunc) BeginRecording(rq *gopher.Request, at time.Time) gopher.Recording {
+	if fn == nil || rq == nil {
+		return nil
+	}
+	return &EntryRecording{
+		add: func(e Entry) { fn(rq, e) },
 		entry: Entry{
 			URL: rq.URL(),
 			At:  at,
@@ -35,10 +59,27 @@ type Entry struct {
 	Msg    string        `json:"msg,omitempty"`
 	In     []byte        `json:"in,omitempty"`
 	Out    []byte        `json:"out"`
+
+	// Timing is nil if the phases of the request weren't timed.
+	Timing *Timing `json:"timing,omitempty"`
+}
+
+// Timing breaks down how long a request took. Phases that didn't happen, like TLS for
+// plain connections, are 0. The phases don't add up to the total time taken if the
+// client had to try more than one connection.
+type Timing struct {
+	DNS     Duration `json:"dns"`
+	Connect Duration `json:"connect"`
+	TLS     Duration `json:"tls"`
+
+	// From when the request was sent until the first byte of the response arrived, and
+	// from then until the last byte arrived.
+	TTFB     Duration `json:"ttfb"`
+	Transfer Duration `json:"transfer"`
 }
 
 type EntryRecording struct {
-	ball  *Ball
+	add   func(e Entry)
 	entry Entry
 	in    bytes.Buffer
 	out   bytes.Buffer
@@ -52,9 +93,14 @@ func (e *EntryRecording) SetStatus(status gopher.Status, msg string) {
 	e.entry.Msg = msg
 }
 
+// SetTiming must be called before Done to be recorded.
+func (e *EntryRecording) SetTiming(t Timing) {
+	e.entry.Timing = &t
+}
+
 func (e *EntryRecording) Done(at time.Time) {
 	e.entry.In = e.in.Bytes()
 	e.entry.Out = e.out.Bytes()
 	e.entry.Taken = Duration(at.Sub(e.entry.At))
-	e.ball.Entries = append(e.ball.Entries, e.entry)
+	e.add(e.entry)
 }
@@ -0,0 +1,218 @@
+package furball
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// A FormatDir furball is a directory containing a manifest, which is a FormatJSONL
+// furball with each response replaced by the SHA-256 of its contents, and a store of
+// gzipped responses named by their SHA-256, so a response that is recorded more than
+// once is only stored once:
+//
+//	ball/
+//	    entries.jsonl
+//	    blobs/
+//	        9f/
+//	            9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08.gz
+const (
+	dirManifest = "entries.jsonl"
+	dirBlobs    = "blobs"
+)
+
+// manifestEntry is an Entry as it is stored in a FormatDir manifest. The Out field
+// shadows Entry.Out when encoding.
+type manifestEntry struct {
+	*Entry
+	Out string `json:"out,omitempty"`
+}
+
+func isDirPath(path string) bool {
+	if info, err := os.Stat(path); err == nil {
+		return info.IsDir()
+	}
+	return len(path) > 0 && os.IsPathSeparator(path[len(path)-1])
+}
+
+// blobStore stores data gzipped in files named by the SHA-256 of the uncompressed data.
+type blobStore struct {
+	dir string
+}
+
+func newBlobStore(ballDir string) *blobStore {
+	return &blobStore{dir: filepath.Join(ballDir, dirBlobs)}
+}
+
+func (bs *blobStore) path(digest string) string {
+	return filepath.Join(bs.dir, digest[:2], digest+".gz")
+}
+
+// put stores data if it isn't already stored, and returns its digest. Empty data isn't
+// stored, and has an empty digest.
+func (bs *blobStore) put(data []byte) (digest string, rerr error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	sum := sha256.Sum256(data)
+	digest = hex.EncodeToString(sum[:])
+
+	path := bs.path(digest)
+	if _, err := os.Stat(path); err == nil {
+		return digest, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return "", fmt.Errorf("furball: store blob failed: %w", err)
+	}
+
+	// Several processes may store the same blob at once, but as the contents will be
+	// the same, it doesn't matter who wins the rename:
+	var b [16]byte
+	rand.Read(b[:])
+	tmpPath := path + "." + hex.EncodeToString(b[:])
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return "", fmt.Errorf("furball: store blob failed: %w", err)
+	}
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+		if rerr != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write(data); err != nil {
+		return "", fmt.Errorf("furball: store blob failed: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return "", fmt.Errorf("furball: store blob failed: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("furball: store blob failed: %w", err)
+	}
+	f = nil
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return "", fmt.Errorf("furball: store blob failed: %w", err)
+	}
+	return digest, nil
+}
+
+func (bs *blobStore) get(digest string) ([]byte, error) {
+	if digest == "" {
+		return []byte{}, nil
+	}
+	if len(digest) != sha256.Size*2 {
+		return nil, fmt.Errorf("furball: invalid blob digest %q", digest)
+	}
+
+	f, err := os.Open(bs.path(digest))
+	if err != nil {
+		return nil, fmt.Errorf("furball: load blob failed: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("furball: load blob %s failed: %w", digest, err)
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("furball: load blob %s failed: %w", digest, err)
+	}
+
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("furball: blob %s is corrupt", digest)
+	}
+	return data, nil
+}
+
+// saveBallDir replaces the manifest of the FormatDir furball at dir with ball. Blobs
+// that are no longer referenced are left in place.
+func saveBallDir(ball *Ball, dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return fmt.Errorf("furball: save dir %q failed: %w", dir, err)
+	}
+
+	i := 0
+	return writeFileAtomic(filepath.Join(dir, dirManifest), func(w io.Writer) error {
+		return writeJSONL(w, newBlobStore(dir), func() (*Entry, error) {
+			if i >= len(ball.Entries) {
+				return nil, io.EOF
+			}
+			i++
+			return &ball.Entries[i-1], nil
+		})
+	})
+}
+
+// openBallDir opens the manifest of the FormatDir furball at dir for reading.
+func openBallDir(dir string) (*Reader, io.Closer, error) {
+	f, err := os.Open(filepath.Join(dir, dirManifest))
+	if err != nil {
+		return nil, nil, fmt.Errorf("furball: load dir %q failed: %w", dir, err)
+	}
+	rdr, err := NewReader(f)
+	if err == nil && rdr.format != FormatJSONL {
+		err = errors.New("manifest is not a JSONL furball")
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("furball: load dir %q failed: %w", dir, err)
+	}
+	rdr.format = FormatDir
+	rdr.blobs = newBlobStore(dir)
+	return rdr, f, nil
+}
+
+func (r *Reader) nextManifestEntry() (*Entry, error) {
+	var e Entry
+	me := manifestEntry{Entry: &e}
+	if err := r.dec.Decode(&me); err == io.EOF {
+		r.done = true
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("furball: decode entry failed: %w", err)
+	}
+
+	var err error
+	if e.Out, err = r.blobs.get(me.Out); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// encodeEntry encodes an entry as a line in a FormatJSONL file, or a FormatDir
+// manifest if blobs is not nil.
+func encodeEntry(e *Entry, blobs *blobStore) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if blobs == nil {
+		if err := enc.Encode(e); err != nil {
+			return nil, fmt.Errorf("furball: encode entry failed: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	digest, err := blobs.put(e.Out)
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(manifestEntry{Entry: e, Out: digest}); err != nil {
+		return nil, fmt.Errorf("furball: encode entry failed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
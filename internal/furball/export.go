@@ -0,0 +1,36 @@
+package furball
+
+import (
+	"net/http"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// Creator is the software name used in exported files.
+const Creator = "fur"
+
+// MenuMimeType is used for menus in exported files. There is no registered type for
+// Gopher menus, so this follows what Lynx and a few proxies use.
+const MenuMimeType = "application/gopher-menu"
+
+// MimeType guesses the MIME type of an entry's response from the item type of its URL,
+// falling back to sniffing the content for types that don't say what format they are.
+func (e *Entry) MimeType() string {
+	if e.URL.Root {
+		return MenuMimeType
+	}
+	switch e.URL.ItemType {
+	case gopher.Dir, gopher.Search:
+		return MenuMimeType
+	case gopher.Text:
+		return "text/plain; charset=utf-8"
+	case gopher.HTML:
+		return "text/html"
+	case gopher.XML:
+		return "text/xml"
+	case gopher.GIF:
+		return "image/gif"
+	default:
+		return http.DetectContentType(e.Out)
+	}
+}
@@ -0,0 +1,117 @@
+package furball
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+var exportBall = &Ball{Entries: []Entry{
+	{
+		URL:   gopher.URL{Hostname: "localhost", Port: "70", ItemType: gopher.Text, Selector: "/hello"},
+		At:    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Taken: Duration(1500 * time.Millisecond),
+		In:    []byte("/hello\r\n"),
+		Out:   []byte("hello\r\n.\r\n"),
+	},
+	{
+		URL:    gopher.URL{Hostname: "localhost", Port: "70", ItemType: gopher.Binary, Selector: "/missing"},
+		Status: gopher.StatusNotFound,
+		Msg:    "Not\nfound",
+		In:     []byte("/missing\r\n"),
+		Out:    []byte{0xff, 0xfe},
+	},
+}}
+
+func TestWriteHAR(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHAR(&buf, exportBall); err != nil {
+		t.Fatal(err)
+	}
+
+	var har HAR
+	if err := json.Unmarshal(buf.Bytes(), &har); err != nil {
+		t.Fatal(err)
+	}
+	if len(har.Log.Entries) != 2 {
+		t.Fatal(len(har.Log.Entries))
+	}
+
+	ok, missing := har.Log.Entries[0], har.Log.Entries[1]
+	if ok.Time != 1500 || ok.Timings.Wait != 1500 || ok.Response.Status != 200 {
+		t.Fatalf("%+v", ok)
+	}
+	if ok.Response.Content.Text != "hello\r\n.\r\n" || ok.Response.Content.Encoding != "" {
+		t.Fatalf("%+v", ok.Response.Content)
+	}
+	if missing.Response.Status != 404 || missing.Response.Content.Encoding != "base64" {
+		t.Fatalf("%+v", missing.Response)
+	}
+}
+
+func TestWriteHARTimings(t *testing.T) {
+	timed := &Ball{Entries: []Entry{{
+		URL:   gopher.URL{Hostname: "localhost", Port: "70", ItemType: gopher.Text, Selector: "/timed"},
+		Taken: Duration(100 * time.Millisecond),
+		Timing: &Timing{
+			DNS:      Duration(10 * time.Millisecond),
+			Connect:  Duration(20 * time.Millisecond),
+			TLS:      Duration(30 * time.Millisecond),
+			TTFB:     Duration(25 * time.Millisecond),
+			Transfer: Duration(5 * time.Millisecond),
+		},
+		Out: []byte("timed\r\n.\r\n"),
+	}}}
+
+	var buf bytes.Buffer
+	if err := WriteHAR(&buf, timed); err != nil {
+		t.Fatal(err)
+	}
+	var har HAR
+	if err := json.Unmarshal(buf.Bytes(), &har); err != nil {
+		t.Fatal(err)
+	}
+
+	// 'connect' includes 'ssl', and the 10ms not accounted for is 'blocked':
+	tt := har.Log.Entries[0].Timings
+	if tt.DNS != 10 || tt.Connect != 50 || tt.SSL != 30 || tt.Wait != 25 || tt.Receive != 5 || tt.Blocked != 10 {
+		t.Fatalf("%+v", tt)
+	}
+}
+
+func TestWriteWARC(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteWARC(&buf, exportBall, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each record is a separate gzip member, which gzip.Reader reads as one stream:
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warc := string(data)
+	if !strings.HasPrefix(warc, "WARC/1.1\r\nWARC-Type: warcinfo\r\n") {
+		t.Fatalf("%q", warc[:40])
+	}
+	if n := strings.Count(warc, "WARC/1.1\r\n"); n != 7 {
+		t.Fatal("records", n)
+	}
+	if !strings.Contains(warc, "fetchTimeMs: 1500\r\n") {
+		t.Fatal("missing fetchTimeMs")
+	}
+	if !strings.Contains(warc, "gopherMessage: Not found\r\n") {
+		t.Fatal("missing gopherMessage")
+	}
+}
@@ -0,0 +1,181 @@
+package furball
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// HAR 1.2, as described in http://www.softwareishard.com/blog/har-12-spec/
+//
+// HAR is built around HTTP, so a few fields are bent to fit:
+//
+//   - The method is always GET, as Gopher has none and some tools reject anything
+//     that isn't an HTTP method.
+//   - Status is 200 for a successful response, otherwise the furball status, which
+//     uses GopherII codes (plus 6xx for errors that don't have one).
+//   - Headers are always empty. The request line is counted as the request's headers.
+//   - If the phases of the request weren't timed, the total time is all attributed to
+//     'wait'. Otherwise, any time not accounted for by the phases (like a failed
+//     attempt to connect using TLS) is attributed to 'blocked'.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+}
+
+type HARRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []struct{}  `json:"cookies"`
+	Headers     []HARHeader `json:"headers"`
+	QueryString []HARHeader `json:"queryString"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []struct{}  `json:"cookies"`
+	Headers     []HARHeader `json:"headers"`
+	Content     HARContent  `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type HARHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+const harProtocol = "Gopher"
+
+// NewHAR converts the entries in ball to HAR.
+func NewHAR(ball *Ball) *HAR {
+	har := &HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: Creator, Version: "1.0"},
+		Entries: make([]HAREntry, 0, len(ball.Entries)),
+	}}
+	for i := range ball.Entries {
+		har.Log.Entries = append(har.Log.Entries, newHAREntry(&ball.Entries[i]))
+	}
+	return har
+}
+
+func newHAREntry(e *Entry) HAREntry {
+	taken := float64(e.Taken) / float64(time.Millisecond)
+
+	status, statusText := 200, "OK"
+	if e.Status != gopher.OK {
+		status, statusText = int(e.Status), e.Msg
+	}
+
+	content := HARContent{Size: len(e.Out), MimeType: e.MimeType()}
+	if utf8.Valid(e.Out) {
+		content.Text = string(e.Out)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(e.Out)
+		content.Encoding = "base64"
+	}
+
+	return HAREntry{
+		StartedDateTime: e.At,
+		Time:            taken,
+		Request: HARRequest{
+			Method:      "GET",
+			URL:         e.URL.String(),
+			HTTPVersion: harProtocol,
+			Cookies:     []struct{}{},
+			Headers:     []HARHeader{},
+			QueryString: []HARHeader{},
+			HeadersSize: len(e.In),
+			BodySize:    0,
+		},
+		Response: HARResponse{
+			Status:      status,
+			StatusText:  statusText,
+			HTTPVersion: harProtocol,
+			Cookies:     []struct{}{},
+			Headers:     []HARHeader{},
+			Content:     content,
+			HeadersSize: 0,
+			BodySize:    len(e.Out),
+		},
+		Timings: harTimings(e, taken),
+	}
+}
+
+func harTimings(e *Entry, taken float64) HARTimings {
+	if e.Timing == nil {
+		return HARTimings{
+			Blocked: -1, DNS: -1, Connect: -1, SSL: -1,
+			Wait: taken,
+		}
+	}
+
+	ms := func(d Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	t := e.Timing
+
+	// HAR counts 'ssl' as part of 'connect' as well:
+	hts := HARTimings{
+		DNS:     ms(t.DNS),
+		Connect: ms(t.Connect + t.TLS),
+		SSL:     ms(t.TLS),
+		Wait:    ms(t.TTFB),
+		Receive: ms(t.Transfer),
+	}
+	if hts.Blocked = taken - hts.DNS - hts.Connect - hts.Wait - hts.Receive; hts.Blocked < 0 {
+		hts.Blocked = 0
+	}
+	return hts
+}
+
+func WriteHAR(w io.Writer, ball *Ball) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(NewHAR(ball))
+}
@@ -0,0 +1,409 @@
+package furball
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shabbyrobe/fur/internal/flock"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// Format of a furball file.
+//
+// FormatJSON is a single JSON object containing every entry, which has to be loaded
+// into memory and rewritten in its entirety to add to it.
+//
+// FormatJSONL is a header line followed by one JSON entry per line, which can be
+// appended to and read one entry at a time.
+//
+// FormatDir is a directory containing a FormatJSONL manifest and a store of compressed
+// responses, so a response that is recorded more than once is only stored once.
+type Format int
+
+const (
+	FormatJSON Format = iota + 1
+	FormatJSONL
+	FormatDir
+)
+
+// JSONLExt is the file extension that selects FormatJSONL for new files.
+const JSONLExt = ".jsonl"
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatJSONL:
+		return "jsonl"
+	case FormatDir:
+		return "dir"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "json":
+		return FormatJSON, nil
+	case "jsonl":
+		return FormatJSONL, nil
+	case "dir":
+		return FormatDir, nil
+	default:
+		return 0, fmt.Errorf("furball: unknown format %q", s)
+	}
+}
+
+// FormatForExt selects the format for a new file from its extension, or FormatDir if
+// path ends with a path separator.
+func FormatForExt(path string) Format {
+	if len(path) > 0 && os.IsPathSeparator(path[len(path)-1]) {
+		return FormatDir
+	}
+	if strings.EqualFold(filepath.Ext(path), JSONLExt) {
+		return FormatJSONL
+	}
+	return FormatJSON
+}
+
+// jsonlHeader is the first line of a FormatJSONL file, which distinguishes it from
+// FormatJSON regardless of the file's name.
+type jsonlHeader struct {
+	Furball string `json:"furball"`
+	Version int    `json:"version"`
+}
+
+const jsonlVersion = 1
+
+// DetectFormat detects the format of the furball at path from its header, or
+// FormatDir if it is a directory. If the file doesn't exist or is empty, the format is
+// selected by FormatForExt.
+func DetectFormat(path string) (Format, error) {
+	if isDirPath(path) {
+		return FormatDir, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return FormatForExt(path), nil
+	} else if err != nil {
+		return 0, fmt.Errorf("furball: open file %q failed: %w", path, err)
+	}
+	defer f.Close()
+
+	format, _, err := detectFormat(bufio.NewReader(f))
+	if err == io.EOF {
+		return FormatForExt(path), nil
+	} else if err != nil {
+		return 0, fmt.Errorf("furball: read file %q failed: %w", path, err)
+	}
+	return format, nil
+}
+
+// detectFormat reads the first line of rdr to check for a jsonlHeader. If there isn't
+// one, the line is returned so it can be replayed to the JSON decoder.
+func detectFormat(rdr *bufio.Reader) (format Format, line []byte, err error) {
+	line, err = rdr.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var hdr jsonlHeader
+	if json.Unmarshal(line, &hdr) == nil && hdr.Furball != "" {
+		if hdr.Furball != FormatJSONL.String() || hdr.Version != jsonlVersion {
+			return 0, nil, fmt.Errorf("furball: unsupported format %q, version %d", hdr.Furball, hdr.Version)
+		}
+		return FormatJSONL, nil, nil
+	}
+	return FormatJSON, line, nil
+}
+
+// Reader reads entries from a furball of either format one at a time, so the whole
+// ball need not fit in memory.
+type Reader struct {
+	dec     *json.Decoder
+	format  Format
+	blobs   *blobStore
+	started bool
+	done    bool
+}
+
+func NewReader(rdr io.Reader) (*Reader, error) {
+	br := bufio.NewReader(rdr)
+	format, line, err := detectFormat(br)
+	if err == io.EOF {
+		return nil, fmt.Errorf("furball: empty file")
+	} else if err != nil {
+		return nil, err
+	}
+
+	var in io.Reader = br
+	if len(line) > 0 {
+		in = io.MultiReader(bytes.NewReader(line), br)
+	}
+	return &Reader{dec: json.NewDecoder(in), format: format}, nil
+}
+
+func (r *Reader) Format() Format { return r.format }
+
+// Next returns the next entry, or io.EOF if there are no more.
+func (r *Reader) Next() (*Entry, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+
+	if r.blobs != nil {
+		return r.nextManifestEntry()
+	}
+
+	if r.format == FormatJSONL {
+		var e Entry
+		if err := r.dec.Decode(&e); err == io.EOF {
+			r.done = true
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, fmt.Errorf("furball: decode entry failed: %w", err)
+		}
+		return &e, nil
+	}
+
+	if !r.started {
+		r.started = true
+		if err := r.seekEntries(); err != nil {
+			return nil, err
+		} else if r.done {
+			return nil, io.EOF
+		}
+	}
+	if !r.dec.More() {
+		r.done = true
+		return nil, io.EOF
+	}
+	var e Entry
+	if err := r.dec.Decode(&e); err != nil {
+		return nil, fmt.Errorf("furball: decode entry failed: %w", err)
+	}
+	return &e, nil
+}
+
+// seekEntries moves the decoder of a FormatJSON ball to the start of the first entry,
+// skipping any other keys in the object.
+func (r *Reader) seekEntries() error {
+	if err := r.expectDelim('{'); err != nil {
+		return err
+	}
+	for r.dec.More() {
+		tok, err := r.dec.Token()
+		if err != nil {
+			return fmt.Errorf("furball: decode failed: %w", err)
+		}
+		if tok == "entries" {
+			return r.seekEntriesArray()
+		}
+		var skip json.RawMessage
+		if err := r.dec.Decode(&skip); err != nil {
+			return fmt.Errorf("furball: decode failed: %w", err)
+		}
+	}
+
+	// No entries; the decoder has nothing left for Next to find:
+	r.done = true
+	return nil
+}
+
+// seekEntriesArray moves past the start of the entries array. Balls with no entries may
+// have been saved with null instead of an empty array.
+func (r *Reader) seekEntriesArray() error {
+	tok, err := r.dec.Token()
+	if err != nil {
+		return fmt.Errorf("furball: decode failed: %w", err)
+	}
+	if tok == nil {
+		r.done = true
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("furball: decode failed: expected %q, found %v", json.Delim('['), tok)
+	}
+	return nil
+}
+
+func (r *Reader) expectDelim(delim json.Delim) error {
+	tok, err := r.dec.Token()
+	if err != nil {
+		return fmt.Errorf("furball: decode failed: %w", err)
+	}
+	if tok != delim {
+		return fmt.Errorf("furball: decode failed: expected %q, found %v", delim, tok)
+	}
+	return nil
+}
+
+// Appender is a gopher.Recorder that appends each entry to a FormatJSONL or FormatDir
+// furball as soon as it is recorded.
+//
+// Errors writing entries can't be returned by the recording, so the first one is
+// returned by Close instead.
+type Appender struct {
+	file  *os.File
+	path  string
+	blobs *blobStore
+	mu    sync.Mutex
+	err   error
+}
+
+var _ gopher.Recorder = &Appender{}
+
+// OpenAppender opens the FormatJSONL or FormatDir furball at path for appending,
+// creating it if it doesn't exist. It is an error if the file exists as a FormatJSON
+// furball.
+//
+// Several processes may append to the same file at once; each entry is written while
+// holding a lock on the file, so entries are never interleaved.
+func OpenAppender(path string) (*Appender, error) {
+	var blobs *blobStore
+	if isDirPath(path) {
+		if err := os.MkdirAll(path, 0777); err != nil {
+			return nil, fmt.Errorf("furball: open dir %q failed: %w", path, err)
+		}
+		blobs = newBlobStore(path)
+		path = filepath.Join(path, dirManifest)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("furball: open file %q failed: %w", path, err)
+	}
+	app := &Appender{file: f, path: path, blobs: blobs}
+
+	// The lock stops two processes that create the file at the same time from both
+	// writing the header:
+	err = app.locked(func() error {
+		format, _, err := detectFormat(bufio.NewReader(f))
+		if err == io.EOF {
+			return writeJSONL(f, nil, func() (*Entry, error) { return nil, io.EOF })
+		} else if err == nil && format != FormatJSONL {
+			return fmt.Errorf("not a %s furball", FormatJSONL)
+		}
+		return err
+	})
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("furball: open file %q failed: %w", path, err)
+	}
+
+	return app, nil
+}
+
+func (a *Appender) BeginRecording(rq *gopher.Request, at time.Time) gopher.Recording {
+	if a == nil || rq == nil {
+		return nil
+	}
+	return &EntryRecording{
+		add: a.add,
+		entry: Entry{
+			URL: rq.URL(),
+			At:  at,
+		},
+	}
+}
+
+func (a *Appender) add(e Entry) {
+	if err := a.Append(&e); err != nil {
+		a.mu.Lock()
+		if a.err == nil {
+			a.err = err
+		}
+		a.mu.Unlock()
+	}
+}
+
+// Append writes e to the end of the file as a single line.
+func (a *Appender) Append(e *Entry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Blobs are stored while holding the lock so that RewriteBallFile doesn't remove
+	// them as unreferenced before the entry that references them is written:
+	err := a.locked(func() error {
+		if err := a.reopenIfReplaced(); err != nil {
+			return err
+		}
+		line, err := encodeEntry(e, a.blobs)
+		if err != nil {
+			return err
+		}
+		_, err = a.file.Write(line)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("furball: append to %q failed: %w", a.path, err)
+	}
+	return nil
+}
+
+// reopenIfReplaced reopens the file if it has been replaced since it was opened, which
+// RewriteBallFile does, so entries aren't appended to a file that no longer exists.
+func (a *Appender) reopenIfReplaced() error {
+	opened, err := a.file.Stat()
+	if err != nil {
+		return err
+	}
+	current, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(opened, current) {
+		return nil
+	}
+
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	a.file.Close()
+	a.file = f
+	return nil
+}
+
+// locked calls fn while holding the lock shared with other processes writing to the
+// file.
+func (a *Appender) locked(fn func() error) (rerr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+
+	lock, err := flock.Acquire(ctx, a.path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := lock.Release(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+	return fn()
+}
+
+func (a *Appender) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cerr := a.file.Close()
+	if a.err != nil {
+		return a.err
+	}
+	return cerr
+}
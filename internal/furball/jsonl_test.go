@@ -0,0 +1,111 @@
+package furball
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+func TestConvertRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	json, jsonl, back := filepath.Join(dir, "ball.json"), filepath.Join(dir, "ball.jsonl"), filepath.Join(dir, "back.json")
+	balldir := filepath.Join(dir, "ball")
+
+	if err := SaveBallFile(exportBall, json); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConvertBallFile(json, jsonl, FormatJSONL); err != nil {
+		t.Fatal(err)
+	}
+
+	// Append to the converted file, then convert it back:
+	app, err := OpenAppender(jsonl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra := Entry{URL: gopher.URL{Hostname: "localhost", Port: "70", Selector: "/extra"}, At: time.Now().UTC(), Out: []byte("x")}
+	if err := app.Append(&extra); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConvertBallFile(jsonl, back, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConvertBallFile(back, balldir, FormatDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Append the same responses again; they should be stored once:
+	if err := AppendBallFile(context.Background(), balldir, exportBall.Entries); err != nil {
+		t.Fatal(err)
+	}
+	blobs, _ := filepath.Glob(filepath.Join(balldir, dirBlobs, "*", "*.gz"))
+	if len(blobs) != 3 {
+		t.Fatal("blobs", blobs)
+	}
+
+	for _, tc := range []struct {
+		path   string
+		format Format
+		n      int
+	}{
+		{json, FormatJSON, 2},
+		{jsonl, FormatJSONL, 3},
+		{back, FormatJSON, 3},
+		{balldir, FormatDir, 5},
+	} {
+		if format, err := DetectFormat(tc.path); err != nil || format != tc.format {
+			t.Fatal(tc.path, format, err)
+		}
+
+		rdr, closer, err := OpenBallFile(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sels []string
+		for {
+			e, err := rdr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(tc.path, err)
+			}
+			sels = append(sels, e.URL.Selector)
+		}
+		closer.Close()
+
+		if len(sels) != tc.n || sels[0] != "/hello" || sels[1] != "/missing" {
+			t.Fatal(tc.path, sels)
+		}
+		if e := ball(t, tc.path).Entries[1]; !bytes.Equal(e.Out, exportBall.Entries[1].Out) {
+			t.Fatal(tc.path, e.Out)
+		}
+	}
+
+	if _, err := OpenAppender(json); err == nil {
+		t.Fatal("expected error appending to a JSON ball")
+	}
+}
+
+func ball(t *testing.T, path string) *Ball {
+	t.Helper()
+	b, err := LoadBallFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -1,46 +1,247 @@
 package furball
 
 import (
+	"bufio"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shabbyrobe/fur/internal/flock"
 )
 
+// LoadBallFile loads every entry in the furball at path, which may be in either
+// format. Use OpenBallFile to read large balls one entry at a time.
 func LoadBallFile(path string) (*Ball, error) {
-	f, err := os.Open(path)
+	rdr, closer, err := OpenBallFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("furball: load file %q failed: %w", path, err)
+		return nil, err
 	}
-	defer f.Close()
+	defer closer.Close()
 
 	var b Ball
-	dec := json.NewDecoder(f)
-	if err := dec.Decode(&b); err != nil {
-		return nil, err
+	for {
+		e, err := rdr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("furball: load file %q failed: %w", path, err)
+		}
+		b.Entries = append(b.Entries, *e)
+	}
+	return &b, nil
+}
+
+// OpenBallFile opens the furball at path for reading one entry at a time. The returned
+// closer must be closed when done.
+func OpenBallFile(path string) (*Reader, io.Closer, error) {
+	if isDirPath(path) {
+		return openBallDir(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("furball: load file %q failed: %w", path, err)
+	}
+	rdr, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("furball: load file %q failed: %w", path, err)
 	}
-	return &b, err
+	return rdr, f, nil
 }
 
+// SaveBallFile replaces the furball at path with ball, in FormatDir if path is a
+// directory, otherwise FormatJSON. Use AppendBallFile if other processes may be writing
+// to the same file.
 func SaveBallFile(ball *Ball, path string) (rerr error) {
+	if isDirPath(path) {
+		return saveBallDir(ball, path)
+	}
+	return writeFileAtomic(path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ball)
+	})
+}
+
+// lockTimeout is how long to wait for another process to finish writing to a furball
+// before giving up. Writes should take milliseconds, not seconds.
+const lockTimeout = 30 * time.Second
+
+// AppendBallFile adds entries to the end of the furball at path, creating it if it
+// doesn't exist.
+//
+// FormatJSON files are locked while they are loaded, appended to and saved, so entries
+// aren't lost when several processes append to the same ball at once. Callers should
+// record into their own Ball and append it when they are done, rather than holding the
+// lock while recording.
+func AppendBallFile(ctx context.Context, path string, entries []Entry) (rerr error) {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return err
+	}
+	if format != FormatJSON {
+		app, err := OpenAppender(path)
+		if err != nil {
+			return err
+		}
+		for i := range entries {
+			if err := app.Append(&entries[i]); err != nil {
+				app.Close()
+				return err
+			}
+		}
+		return app.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lockTimeout)
+	defer cancel()
+
+	lock, err := flock.Acquire(ctx, path)
+	if err != nil {
+		return fmt.Errorf("furball: append to %q failed: %w", path, err)
+	}
+	defer func() {
+		if err := lock.Release(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+
+	ball, err := LoadBallFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		ball = &Ball{}
+	} else if err != nil {
+		return err
+	}
+	ball.Entries = append(ball.Entries, entries...)
+	return SaveBallFile(ball, path)
+}
+
+// ConvertBallFile writes the furball at in to out using the given format, without
+// loading it into memory unless the format is FormatJSON. If the format is FormatDir,
+// out must not already exist.
+func ConvertBallFile(in, out string, format Format) (rerr error) {
+	if format == FormatJSON {
+		ball, err := LoadBallFile(in)
+		if err != nil {
+			return err
+		}
+		return SaveBallFile(ball, out)
+	}
+
+	rdr, closer, err := OpenBallFile(in)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	next := func() (*Entry, error) {
+		e, err := rdr.Next()
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("furball: convert file %q failed: %w", in, err)
+		}
+		return e, err
+	}
+
+	switch format {
+	case FormatJSONL:
+		return writeFileAtomic(out, func(w io.Writer) error {
+			return writeJSONL(w, nil, next)
+		})
+
+	case FormatDir:
+		// The directory is built under a temporary name, then renamed into place, so
+		// out doesn't exist until it is complete:
+		out = filepath.Clean(out)
+		if _, err := os.Stat(out); err == nil {
+			return fmt.Errorf("furball: convert to %q failed: file exists", out)
+		}
+
+		var b [16]byte
+		rand.Read(b[:])
+		tmpDir := out + "." + hex.EncodeToString(b[:])
+		defer func() {
+			if rerr != nil {
+				os.RemoveAll(tmpDir)
+			}
+		}()
+		if err := os.Mkdir(tmpDir, 0777); err != nil {
+			return err
+		}
+
+		err := writeFileAtomic(filepath.Join(tmpDir, dirManifest), func(w io.Writer) error {
+			return writeJSONL(w, newBlobStore(tmpDir), next)
+		})
+		if err != nil {
+			return err
+		}
+		return os.Rename(tmpDir, out)
+
+	default:
+		return fmt.Errorf("furball: unknown format %s", format)
+	}
+}
+
+// writeJSONL writes a FormatJSONL file, or a FormatDir manifest if blobs is not nil,
+// containing every entry returned by next until it returns io.EOF.
+func writeJSONL(w io.Writer, blobs *blobStore, next func() (*Entry, error)) error {
+	hdr, err := json.Marshal(jsonlHeader{Furball: FormatJSONL.String(), Version: jsonlVersion})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(hdr, '\n')); err != nil {
+		return err
+	}
+
+	for {
+		e, err := next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		line, err := encodeEntry(e, blobs)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+	}
+}
+
+// writeFileAtomic writes a file using fn via a temporary file that is renamed over path
+// when fn succeeds.
+func writeFileAtomic(path string, fn func(w io.Writer) error) (rerr error) {
 	var b [16]byte
 	rand.Read(b[:])
 
 	tmpPath := path + "." + hex.EncodeToString(b[:])
 	f, err := os.Create(tmpPath)
 	if err != nil {
-		return fmt.Errorf("furball: load file %q failed: %w", path, err)
+		return fmt.Errorf("furball: save file %q failed: %w", path, err)
 	}
 	defer func() {
 		if f != nil {
 			f.Close()
 		}
+		if rerr != nil {
+			os.Remove(tmpPath)
+		}
 	}()
 
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(ball); err != nil {
+	bufw := bufio.NewWriter(f)
+	if err := fn(bufw); err != nil {
+		return err
+	}
+	if err := bufw.Flush(); err != nil {
 		return err
 	}
 	if err := f.Close(); err != nil {
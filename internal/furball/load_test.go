@@ -0,0 +1,45 @@
+package furball
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestAppendBallFileConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ball.json")
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- AppendBallFile(context.Background(), path, exportBall.Entries)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ball, err := LoadBallFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ball.Entries) != n*len(exportBall.Entries) {
+		t.Fatal(len(ball.Entries))
+	}
+}
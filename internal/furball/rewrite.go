@@ -0,0 +1,125 @@
+package furball
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shabbyrobe/fur/internal/flock"
+)
+
+// RewriteBallFile replaces the furball at path with only the entries for which keep
+// returns true, in the same format, and returns the number of entries removed.
+//
+// The ball is locked while it is rewritten, so entries appended by other processes in
+// the meantime aren't lost. Responses in a FormatDir ball that are no longer referenced
+// are removed.
+func RewriteBallFile(ctx context.Context, path string, keep func(e *Entry) bool) (removed int, rerr error) {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	file := path
+	if format == FormatDir {
+		file = filepath.Join(path, dirManifest)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lockTimeout)
+	defer cancel()
+	lock, err := flock.Acquire(ctx, file)
+	if err != nil {
+		return 0, fmt.Errorf("furball: rewrite %q failed: %w", path, err)
+	}
+	defer func() {
+		if err := lock.Release(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+
+	rdr, closer, err := OpenBallFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+
+	digests := map[string]bool{}
+	next := func() (*Entry, error) {
+		for {
+			e, err := rdr.Next()
+			if err == io.EOF {
+				return nil, err
+			} else if err != nil {
+				return nil, fmt.Errorf("furball: rewrite %q failed: %w", path, err)
+			}
+			if keep(e) {
+				sum := sha256.Sum256(e.Out)
+				digests[hex.EncodeToString(sum[:])] = true
+				return e, nil
+			}
+			removed++
+		}
+	}
+
+	switch format {
+	case FormatJSON:
+		// Entries must not be nil, or a ball with every entry removed would be saved with
+		// null entries:
+		ball := Ball{Entries: []Entry{}}
+		for {
+			e, err := next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return 0, err
+			}
+			ball.Entries = append(ball.Entries, *e)
+		}
+		return removed, SaveBallFile(&ball, path)
+
+	case FormatJSONL:
+		return removed, writeFileAtomic(path, func(w io.Writer) error {
+			return writeJSONL(w, nil, next)
+		})
+
+	case FormatDir:
+		blobs := newBlobStore(path)
+		err := writeFileAtomic(file, func(w io.Writer) error {
+			return writeJSONL(w, blobs, next)
+		})
+		if err != nil {
+			return 0, err
+		}
+		return removed, blobs.removeExcept(digests)
+
+	default:
+		return 0, fmt.Errorf("furball: unknown format %s", format)
+	}
+}
+
+// removeExcept removes every blob whose digest is not in keep.
+func (bs *blobStore) removeExcept(keep map[string]bool) error {
+	return filepath.Walk(bs.dir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		digest := strings.TrimSuffix(info.Name(), ".gz")
+		if keep[digest] {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("furball: remove blob failed: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,109 @@
+package furball
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+func TestRewriteBallFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, path := range []string{
+		filepath.Join(dir, "ball.json"),
+		filepath.Join(dir, "ball.jsonl"),
+		filepath.Join(dir, "ball") + string(filepath.Separator),
+	} {
+		if err := AppendBallFile(context.Background(), path, exportBall.Entries); err != nil {
+			t.Fatal(err)
+		}
+
+		// An appender opened before the rewrite must still append to the new file:
+		var app *Appender
+		if FormatForExt(path) != FormatJSON {
+			if app, err = OpenAppender(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		removed, err := RewriteBallFile(context.Background(), path, func(e *Entry) bool {
+			return e.Status == gopher.OK
+		})
+		if err != nil {
+			t.Fatal(path, err)
+		} else if removed != 1 {
+			t.Fatal(path, "removed", removed)
+		}
+
+		want := 1
+		if app != nil {
+			if err := app.Append(&exportBall.Entries[0]); err != nil {
+				t.Fatal(err)
+			}
+			if err := app.Close(); err != nil {
+				t.Fatal(err)
+			}
+			want++
+		}
+		if b := ball(t, path); len(b.Entries) != want {
+			t.Fatal(path, len(b.Entries))
+		}
+	}
+
+	blobs, _ := filepath.Glob(filepath.Join(dir, "ball", dirBlobs, "*", "*.gz"))
+	if len(blobs) != 1 {
+		t.Fatal("unreferenced blobs not removed", blobs)
+	}
+}
+
+func TestRewriteBallFileRemoveAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, path := range []string{
+		filepath.Join(dir, "ball.json"),
+		filepath.Join(dir, "ball.jsonl"),
+		filepath.Join(dir, "ball") + string(filepath.Separator),
+	} {
+		if err := AppendBallFile(context.Background(), path, exportBall.Entries); err != nil {
+			t.Fatal(err)
+		}
+		removed, err := RewriteBallFile(context.Background(), path, func(e *Entry) bool { return false })
+		if err != nil {
+			t.Fatal(path, err)
+		} else if removed != len(exportBall.Entries) {
+			t.Fatal(path, "removed", removed)
+		}
+		if b := ball(t, path); len(b.Entries) != 0 {
+			t.Fatal(path, len(b.Entries))
+		}
+
+		// The emptied ball must still be appendable:
+		if err := AppendBallFile(context.Background(), path, exportBall.Entries[:1]); err != nil {
+			t.Fatal(path, err)
+		}
+		if b := ball(t, path); len(b.Entries) != 1 {
+			t.Fatal(path, len(b.Entries))
+		}
+	}
+
+	// Balls emptied before Entries was initialised were saved with null entries:
+	path := filepath.Join(dir, "null.json")
+	if err := ioutil.WriteFile(path, []byte(`{"entries": null, "other": 1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if b := ball(t, path); len(b.Entries) != 0 {
+		t.Fatal(path, len(b.Entries))
+	}
+}
@@ -0,0 +1,78 @@
+package furball
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// Handler is a gopher.Handler that answers each request with the response recorded for
+// it in a Ball, byte-for-byte, so errors are served exactly as the original server sent
+// them.
+//
+// Entries are matched against the request line, which is taken from Entry.In, or from
+// the selector and search in Entry.URL if the entry has no request recorded. If more
+// than one entry matches, the one recorded last wins. Requests that match no entry get
+// a '3' error.
+type Handler struct {
+	entries map[string]*Entry
+}
+
+var _ gopher.Handler = &Handler{}
+
+func NewHandler(ball *Ball) *Handler {
+	h := &Handler{entries: make(map[string]*Entry, len(ball.Entries))}
+	for i := range ball.Entries {
+		e := &ball.Entries[i]
+		h.entries[entryKey(e)] = e
+	}
+	return h
+}
+
+func (h *Handler) ServeGopher(ctx context.Context, w gopher.ResponseWriter, rq *gopher.Request) {
+	u := rq.URL()
+	e, ok := h.entries[requestKey(u.Selector, u.Search)]
+	if !ok {
+		gopher.NotFound(w, rq)
+		return
+	}
+
+	if len(e.Out) == 0 && e.Status != gopher.OK {
+		dw := gopher.NewDirWriter(w, rq)
+		defer gopher.MustFlush(dw)
+		dw.Error(fmt.Sprintf("Error: %d, %s", e.Status, e.Msg))
+		return
+	}
+	w.Write(e.Out)
+}
+
+func entryKey(e *Entry) string {
+	if len(e.In) == 0 {
+		return requestKey(e.URL.Selector, e.URL.Search)
+	}
+
+	// Only the request line is used; In may also contain a request body:
+	line := e.In
+	if idx := bytes.IndexByte(line, '\n'); idx >= 0 {
+		line = line[:idx]
+	}
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+
+	// Clients may send extra fields after the search, like GopherII's file flag, which
+	// the server doesn't pass on to the handler:
+	fields := strings.SplitN(string(line), "\t", 3)
+	if len(fields) == 1 {
+		return fields[0]
+	}
+	return requestKey(fields[0], fields[1])
+}
+
+func requestKey(selector, search string) string {
+	if search != "" {
+		return selector + "\t" + search
+	}
+	return selector
+}
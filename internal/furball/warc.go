@@ -0,0 +1,187 @@
+package furball
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// WARC 1.1 (ISO 28500:2017), as described in
+// https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/
+//
+// Each entry produces a 'request' record containing the request exactly as it was
+// sent, a 'response' record containing the response exactly as it was received, and a
+// 'metadata' record with the time taken and the status, using the same 'fetchTimeMs'
+// field as Heritrix.
+
+const warcVersion = "WARC/1.1"
+
+const warcRequestMimeType = "text/plain"
+
+// WriteWARC writes the entries in ball as a WARC file, starting with a 'warcinfo'
+// record. If compress is true, each record is written as its own gzip member, as
+// expected of a '.warc.gz' file.
+func WriteWARC(w io.Writer, ball *Ball, compress bool) error {
+	bw := bufio.NewWriter(w)
+	ww := &warcWriter{w: bw, compress: compress}
+
+	info := warcFields{
+		{"software", Creator},
+		{"format", "WARC File Format 1.1"},
+		{"conformsTo", "http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/"},
+	}
+	if _, err := ww.write(warcRecord{
+		Type:        "warcinfo",
+		Date:        time.Now(),
+		ContentType: "application/warc-fields",
+		Block:       info.Bytes(),
+	}); err != nil {
+		return err
+	}
+
+	for i := range ball.Entries {
+		if err := ww.writeEntry(&ball.Entries[i]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+type warcWriter struct {
+	w        io.Writer
+	compress bool
+	buf      bytes.Buffer
+}
+
+func (ww *warcWriter) writeEntry(e *Entry) error {
+	u := e.URL.String()
+
+	rsID, err := ww.write(warcRecord{
+		Type:        "response",
+		Date:        e.At,
+		TargetURI:   u,
+		ContentType: e.MimeType(),
+		Block:       e.Out,
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := ww.write(warcRecord{
+		Type:         "request",
+		Date:         e.At,
+		TargetURI:    u,
+		ConcurrentTo: rsID,
+		ContentType:  warcRequestMimeType,
+		Block:        e.In,
+	}); err != nil {
+		return err
+	}
+
+	meta := warcFields{
+		{"fetchTimeMs", strconv.FormatInt(int64(time.Duration(e.Taken)/time.Millisecond), 10)},
+	}
+	if e.Status != gopher.OK {
+		meta = append(meta,
+			warcField{"gopherStatus", strconv.Itoa(int(e.Status))},
+			warcField{"gopherMessage", e.Msg})
+	}
+	_, err = ww.write(warcRecord{
+		Type:         "metadata",
+		Date:         e.At,
+		TargetURI:    u,
+		ConcurrentTo: rsID,
+		ContentType:  "application/warc-fields",
+		Block:        meta.Bytes(),
+	})
+	return err
+}
+
+type warcRecord struct {
+	Type         string
+	Date         time.Time
+	TargetURI    string
+	ConcurrentTo string
+	ContentType  string
+	Block        []byte
+}
+
+// write writes rec and returns its WARC-Record-ID.
+func (ww *warcWriter) write(rec warcRecord) (id string, err error) {
+	id, err = newRecordID()
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha1.Sum(rec.Block)
+
+	buf := &ww.buf
+	buf.Reset()
+	buf.WriteString(warcVersion + "\r\n")
+	fmt.Fprintf(buf, "WARC-Type: %s\r\n", rec.Type)
+	fmt.Fprintf(buf, "WARC-Record-ID: %s\r\n", id)
+	fmt.Fprintf(buf, "WARC-Date: %s\r\n", rec.Date.UTC().Format(time.RFC3339Nano))
+	if rec.TargetURI != "" {
+		fmt.Fprintf(buf, "WARC-Target-URI: %s\r\n", rec.TargetURI)
+	}
+	if rec.ConcurrentTo != "" {
+		fmt.Fprintf(buf, "WARC-Concurrent-To: %s\r\n", rec.ConcurrentTo)
+	}
+	if len(rec.Block) > 0 {
+		fmt.Fprintf(buf, "Content-Type: %s\r\n", rec.ContentType)
+	}
+	fmt.Fprintf(buf, "WARC-Block-Digest: sha1:%s\r\n", base32.StdEncoding.EncodeToString(digest[:]))
+	fmt.Fprintf(buf, "Content-Length: %d\r\n", len(rec.Block))
+	buf.WriteString("\r\n")
+	buf.Write(rec.Block)
+	buf.WriteString("\r\n\r\n")
+
+	if !ww.compress {
+		_, err = ww.w.Write(buf.Bytes())
+		return id, err
+	}
+
+	gz := gzip.NewWriter(ww.w)
+	if _, err := gz.Write(buf.Bytes()); err != nil {
+		return "", err
+	}
+	return id, gz.Close()
+}
+
+// newRecordID creates a random (version 4) UUID URN for use as a WARC-Record-ID.
+func newRecordID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+type warcField struct {
+	Name, Value string
+}
+
+type warcFields []warcField
+
+// Values can't span lines; servers can put anything they like in error messages:
+var warcFieldReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+func (fields warcFields) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, f := range fields {
+		fmt.Fprintf(&buf, "%s: %s\r\n", f.Name, warcFieldReplacer.Replace(f.Value))
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,161 @@
+// Package gopherdiff compares two responses for the same gopher URL: menus by the
+// items in them, text line by line, and anything else by hash.
+package gopherdiff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+type Kind int
+
+const (
+	Binary Kind = iota
+	Text
+	Menu
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Binary:
+		return "binary"
+	case Text:
+		return "text"
+	case Menu:
+		return "menu"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// KindOf decides how a response for u should be compared. Responses for other item
+// types are compared as text if they look like it.
+func KindOf(u gopher.URL, data []byte) Kind {
+	if u.Root || u.ItemType == gopher.Dir || u.ItemType.IsSearch() {
+		return Menu
+	}
+	if utf8.Valid(data) && bytes.IndexByte(data, 0) < 0 {
+		return Text
+	}
+	return Binary
+}
+
+// TextLines splits a text response into lines, removing the '.' terminator and line
+// endings.
+func TextLines(data []byte) []string {
+	text, err := ioutil.ReadAll(gopher.NewTextReader(bytes.NewReader(data)))
+	if err != nil {
+		// The terminator is optional in practice, so fall back to the raw response:
+		text = data
+	}
+	s := strings.TrimSuffix(string(text), "\n")
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	return lines
+}
+
+type MenuChange struct {
+	Op  Op
+	Old *gopher.Dirent
+	New *gopher.Dirent
+}
+
+// Menus compares the items in two menus. Items that link somewhere are matched by
+// selector, host and port, and are Changed if their type or display string is
+// different. Info and error lines are matched by their display string, so they can only
+// be added or removed.
+//
+// Deleted items are returned in the order they appear in a, followed by inserted and
+// changed items in the order they appear in b.
+func Menus(a, b []byte) ([]MenuChange, error) {
+	as, err := parseMenu(a)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := parseMenu(b)
+	if err != nil {
+		return nil, err
+	}
+
+	aKeys := menuKeys(as)
+	bKeys := menuKeys(bs)
+	inA := make(map[string]int, len(as))
+	for i, key := range aKeys {
+		inA[key] = i
+	}
+	inB := make(map[string]bool, len(bs))
+	for _, key := range bKeys {
+		inB[key] = true
+	}
+
+	var changes []MenuChange
+	for i, key := range aKeys {
+		if !inB[key] {
+			changes = append(changes, MenuChange{Op: Delete, Old: &as[i]})
+		}
+	}
+	for i, key := range bKeys {
+		ai, ok := inA[key]
+		if !ok {
+			changes = append(changes, MenuChange{Op: Insert, New: &bs[i]})
+		} else if as[ai].ItemType != bs[i].ItemType || as[ai].Display != bs[i].Display {
+			changes = append(changes, MenuChange{Op: Changed, Old: &as[ai], New: &bs[i]})
+		}
+	}
+	return changes, nil
+}
+
+func parseMenu(data []byte) ([]gopher.Dirent, error) {
+	rdr := gopher.NewDirReader(bytes.NewReader(data))
+	rdr.Flag = gopher.DirentHostOptional
+
+	var dirents []gopher.Dirent
+	var dirent gopher.Dirent
+	for rdr.Read(&dirent) {
+		dirents = append(dirents, dirent)
+	}
+	if err := rdr.ReadErr(); err != nil {
+		return nil, err
+	}
+	return dirents, nil
+}
+
+// menuKeys returns the key that each dirent is matched by. Keys that appear more than
+// once are numbered, so repeated items are matched in order.
+func menuKeys(dirents []gopher.Dirent) []string {
+	keys := make([]string, len(dirents))
+	seen := make(map[string]int, len(dirents))
+	for i, d := range dirents {
+		var key string
+		if d.ItemType == gopher.Info || d.ItemType == gopher.ItemError {
+			key = string(d.ItemType) + d.Display
+		} else {
+			key = "\t" + d.Selector + "\t" + d.Hostname + "\t" + d.Port
+		}
+		n := seen[key]
+		seen[key]++
+		if n > 0 {
+			key = fmt.Sprintf("%s\t#%d", key, n)
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+// Hash returns the SHA-256 of data, for comparing binary responses.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
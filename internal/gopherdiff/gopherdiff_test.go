@@ -0,0 +1,101 @@
+package gopherdiff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	for idx, tc := range []struct {
+		a, b  string
+		edits int
+	}{
+		{"", "", 0},
+		{"a b c", "a b c", 0},
+		{"", "a b", 2},
+		{"a b", "", 2},
+		{"a b c a b b a", "c b a b a c", 5},
+		{"a b c d e", "a x c d y", 4},
+		{"x a b c", "a b c x", 2},
+	} {
+		t.Run("", func(t *testing.T) {
+			a, b := strings.Fields(tc.a), strings.Fields(tc.b)
+
+			var ra, rb []string
+			var edits int
+			for _, l := range Lines(a, b) {
+				if l.Op != Insert {
+					ra = append(ra, l.Text)
+				}
+				if l.Op != Delete {
+					rb = append(rb, l.Text)
+				}
+				if l.Op != Equal {
+					edits++
+				}
+			}
+			if fmt.Sprint(ra) != fmt.Sprint(a) || fmt.Sprint(rb) != fmt.Sprint(b) {
+				t.Fatalf("%d: script doesn't produce inputs: %v, %v", idx, ra, rb)
+			}
+			if edits != tc.edits {
+				t.Fatalf("%d: %d edits != %d", idx, edits, tc.edits)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := strings.Fields("1 2 3 4 5 6 7 8 9 10 11 12")
+	b := strings.Fields("1 2 x 4 5 6 7 8 9 10 11")
+
+	var buf bytes.Buffer
+	if err := Unified(&buf, "a", "b", Lines(a, b), 1); err != nil {
+		t.Fatal(err)
+	}
+	expected := "" +
+		"--- a\n+++ b\n" +
+		"@@ -2,3 +2,3 @@\n 2\n-3\n+x\n 4\n" +
+		"@@ -11,2 +11,1 @@\n 11\n-12\n"
+	if buf.String() != expected {
+		t.Fatalf("%q != %q", buf.String(), expected)
+	}
+}
+
+func TestMenus(t *testing.T) {
+	a := "" +
+		"iWelcome\t\terror.invalid\t0\r\n" +
+		"1Phlog\t/phlog\thost\t70\r\n" +
+		"0About\t/about\thost\t70\r\n" +
+		"0Dupe\t/dupe\thost\t70\r\n" +
+		".\r\n"
+	b := "" +
+		"iWelcome!\t\terror.invalid\t0\r\n" +
+		"1Phlog\t/phlog\thost\t70\r\n" +
+		"0About me\t/about\thost\t70\r\n" +
+		"0Dupe\t/dupe\thost\t70\r\n" +
+		"0Dupe\t/dupe\thost\t70\r\n" +
+		"0Moved\t/phlog\tother\t70\r\n" +
+		".\r\n"
+
+	changes, err := Menus([]byte(a), []byte(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for _, c := range changes {
+		switch c.Op {
+		case Delete:
+			result = append(result, "-"+c.Old.Display)
+		case Insert:
+			result = append(result, "+"+c.New.Display)
+		case Changed:
+			result = append(result, "~"+c.Old.Display+">"+c.New.Display)
+		}
+	}
+	expected := "-Welcome +Welcome! ~About>About me +Dupe +Moved"
+	if strings.Join(result, " ") != expected {
+		t.Fatalf("%q != %q", strings.Join(result, " "), expected)
+	}
+}
@@ -0,0 +1,200 @@
+package gopherdiff
+
+import (
+	"fmt"
+	"io"
+)
+
+type Op byte
+
+const (
+	Equal   Op = ' '
+	Delete  Op = '-'
+	Insert  Op = '+'
+	Changed Op = '~'
+)
+
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// maxEdits limits the work done by Lines, which is quadratic in the number of edits.
+// Inputs that need more edits than this are treated as if they have nothing in
+// common.
+const maxEdits = 4000
+
+// Lines finds the shortest edit script that turns a into b, using Myers' O(ND)
+// algorithm.
+func Lines(a, b []string) []Line {
+	// Common prefixes and suffixes are cheap to strip and very common in practice:
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	out := make([]Line, 0, len(a)+len(b))
+	for _, s := range a[:pre] {
+		out = append(out, Line{Equal, s})
+	}
+	out = append(out, myers(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, s := range a[len(a)-suf:] {
+		out = append(out, Line{Equal, s})
+	}
+	return out
+}
+
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxEdits {
+		max = maxEdits
+	}
+
+	// v[off+k] is the furthest x reached on diagonal k. trace[d] is a copy of the
+	// diagonals -d to d of v as it was before step d, for backtracking:
+	off := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		snap := make([]int, 2*d+1)
+		copy(snap, v[off-d:off+d+1])
+		trace = append(trace, snap)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+
+	// Too different to be worth finding the shortest script:
+	out := make([]Line, 0, n+m)
+	for _, s := range a {
+		out = append(out, Line{Delete, s})
+	}
+	for _, s := range b {
+		out = append(out, Line{Insert, s})
+	}
+	return out
+}
+
+func backtrack(trace [][]int, a, b []string) []Line {
+	out := make([]Line, 0, len(a)+len(b))
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d > 0; d-- {
+		snap := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && snap[d+k-1] < snap[d+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := snap[d+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			out = append(out, Line{Equal, a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			out = append(out, Line{Insert, b[y-1]})
+		} else {
+			out = append(out, Line{Delete, a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 {
+		out = append(out, Line{Equal, a[x-1]})
+		x--
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// Unified writes lines as a unified diff with the given number of lines of context
+// around each change. Nothing is written if there are no changes.
+func Unified(w io.Writer, aName, bName string, lines []Line, context int) error {
+	// aLine and bLine are the number of lines of a and b before each line:
+	aLine := make([]int, len(lines)+1)
+	bLine := make([]int, len(lines)+1)
+	var changes []int
+	for i, l := range lines {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if l.Op != Insert {
+			aLine[i+1]++
+		}
+		if l.Op != Delete {
+			bLine[i+1]++
+		}
+		if l.Op != Equal {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", aName, bName); err != nil {
+		return err
+	}
+
+	for i := 0; i < len(changes); {
+		start := changes[i] - context
+		if start < 0 {
+			start = 0
+		}
+
+		// Changes close enough together that their context would touch share a hunk:
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= context*2+1 {
+			j++
+		}
+		end := changes[j] + context + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		aStart, aLen := aLine[start]+1, aLine[end]-aLine[start]
+		bStart, bLen := bLine[start]+1, bLine[end]-bLine[start]
+		if aLen == 0 {
+			aStart--
+		}
+		if bLen == 0 {
+			bStart--
+		}
+		if _, err := fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen); err != nil {
+			return err
+		}
+		for _, l := range lines[start:end] {
+			if _, err := fmt.Fprintf(w, "%c%s\n", l.Op, l.Text); err != nil {
+				return err
+			}
+		}
+
+		i = j + 1
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package linkcheck finds broken links in the results of a crawl.
+package linkcheck
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/shabbyrobe/fur/internal/crawl"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const (
+	CodeDead      = "dead"
+	CodeTimeout   = "timeout"
+	CodeStatus    = "status"
+	CodeEmpty     = "empty"
+	CodeErrorItem = "erroritem"
+	CodeError     = "error"
+)
+
+// Problem with a single URL. Status is the closest gopher.Status to the problem, even
+// if the server didn't report it, so problems can be mapped to exit codes like any
+// other error.
+type Problem struct {
+	URL    gopher.URL    `json:"url"`
+	Parent *gopher.URL   `json:"parent,omitempty"`
+	Code   string        `json:"code"`
+	Status gopher.Status `json:"status"`
+	Msg    string        `json:"msg"`
+}
+
+func (p Problem) String() string {
+	if p.Parent != nil {
+		return fmt.Sprintf("%s: %s: %s (linked from %s)", p.URL, p.Code, p.Msg, p.Parent)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.URL, p.Code, p.Msg)
+}
+
+// Check the result of fetching a URL, and return every problem found. URLs that were
+// skipped because of robots.txt aren't a problem.
+func Check(rs *crawl.Result) (problems []Problem) {
+	add := func(code string, status gopher.Status, msg string, args ...interface{}) {
+		problems = append(problems, Problem{
+			URL:    rs.URL,
+			Parent: rs.Parent,
+			Code:   code,
+			Status: status,
+			Msg:    fmt.Sprintf(msg, args...),
+		})
+	}
+
+	if rs.Err == crawl.ErrRobots {
+		return nil
+	}
+	if rs.Err != nil {
+		code, status := Classify(rs.Err)
+		add(code, status, "%v", rs.Err)
+		return problems
+	}
+	if rs.Entry == nil {
+		return nil
+	}
+
+	data := bytes.TrimSpace(rs.Entry.Out)
+	if len(data) == 0 || (len(data) == 1 && data[0] == '.') {
+		add(CodeEmpty, gopher.StatusEmpty, "empty response")
+		return problems
+	}
+
+	if crawl.IsMenu(rs.URL) {
+		rdr := gopher.NewDirReader(bytes.NewReader(rs.Entry.Out))
+		rdr.Flag = gopher.DirentHostOptional
+		var dirent gopher.Dirent
+		for rdr.Read(&dirent) {
+			if dirent.ItemType == gopher.ItemError {
+				add(CodeErrorItem, gopher.StatusGeneralError, "error item in menu: %q", dirent.Display)
+			}
+		}
+		// Invalid menus have already been reported by the crawl as rs.Err.
+	}
+	return problems
+}
+
+// Classify finds the code and status for an error fetching a URL. Timeouts are checked
+// before dead hosts, as a dial that times out is both.
+func Classify(err error) (code string, status gopher.Status) {
+	var gopherErr *gopher.Error
+	if errors.As(err, &gopherErr) {
+		if gopherErr.Status == gopher.StatusEmpty {
+			return CodeEmpty, gopherErr.Status
+		}
+		return CodeStatus, gopherErr.Status
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return CodeTimeout, gopher.StatusRequestTimeout
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) || (errors.As(err, &opErr) && opErr.Op == "dial") {
+		return CodeDead, gopher.StatusUnavailable
+	}
+
+	return CodeError, gopher.StatusGeneralError
+}
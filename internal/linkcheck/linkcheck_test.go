@@ -0,0 +1,65 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/shabbyrobe/fur/internal/crawl"
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestCheck(t *testing.T) {
+	menu := gopher.URL{Scheme: "gopher", Hostname: "host", ItemType: gopher.Dir, Selector: "/"}
+	text := gopher.URL{Scheme: "gopher", Hostname: "host", ItemType: gopher.Text, Selector: "/t"}
+
+	for idx, tc := range []struct {
+		url    gopher.URL
+		out    string
+		err    error
+		codes  string
+		status gopher.Status
+	}{
+		{text, "hello\r\n.\r\n", nil, "", 0},
+		{menu, "1Menu\t/\thost\t70\r\n.\r\n", nil, "", 0},
+		{text, "", crawl.ErrRobots, "", 0},
+		{text, "", gopher.NewError(text, gopher.StatusNotFound, "nope", 1), "status", gopher.StatusNotFound},
+		{text, "", fmt.Errorf("wrapped: %w", gopher.NewError(text, gopher.StatusEmpty, "", 1)), "empty", gopher.StatusEmpty},
+		{text, "", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, "dead", gopher.StatusUnavailable},
+		{text, "", &net.DNSError{Err: "no such host", Name: "host"}, "dead", gopher.StatusUnavailable},
+		{text, "", &net.OpError{Op: "dial", Err: timeoutErr{}}, "timeout", gopher.StatusRequestTimeout},
+		{text, "", context.DeadlineExceeded, "timeout", gopher.StatusRequestTimeout},
+		{text, "", &net.OpError{Op: "read", Err: errors.New("connection reset")}, "error", gopher.StatusGeneralError},
+		{text, "", nil, "empty", gopher.StatusEmpty},
+		{text, " .\r\n", nil, "empty", gopher.StatusEmpty},
+		{menu, "3Oops\t\terror.invalid\t0\r\n1Menu\t/\thost\t70\r\n3Again\r\n.\r\n", nil, "erroritem erroritem", gopher.StatusGeneralError},
+	} {
+		t.Run("", func(t *testing.T) {
+			rs := &crawl.Result{Item: crawl.Item{URL: tc.url}, Err: tc.err}
+			if tc.err == nil {
+				rs.Entry = &furball.Entry{Out: []byte(tc.out)}
+			}
+
+			var codes []string
+			for _, p := range Check(rs) {
+				codes = append(codes, p.Code)
+				if p.Status != tc.status {
+					t.Fatalf("%d: status %d != %d", idx, p.Status, tc.status)
+				}
+			}
+			if result := strings.Join(codes, " "); result != tc.codes {
+				t.Fatalf("%d: %q != %q", idx, result, tc.codes)
+			}
+		})
+	}
+}
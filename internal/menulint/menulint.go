@@ -0,0 +1,176 @@
+package menulint
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const (
+	CodeFields     = "fields"
+	CodePort       = "port"
+	CodeCRLF       = "crlf"
+	CodeTerminator = "terminator"
+	CodeItemType   = "itemtype"
+	CodeDummyHost  = "dummyhost"
+	CodeControl    = "control"
+)
+
+// Problem with a single line of a menu. Problems that apply to the whole menu, like a
+// missing terminator, are reported against the line after the last one.
+type Problem struct {
+	Line int    `json:"line"`
+	Code string `json:"code"`
+	Msg  string `json:"msg"`
+	Raw  string `json:"raw,omitempty"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("line %d: %s: %s", p.Line, p.Code, p.Msg)
+}
+
+type Flags int
+
+const (
+	// Gophermap files are interpreted by the server rather than sent as-is, so they
+	// don't need CRLF line endings or the '.' terminator. Lines without a tab are sent
+	// as info lines, and the server fills in the host and port if they're left out.
+	Gophermap Flags = 1 << iota
+)
+
+// Item types from RFC 1436, Gopher+ and GopherII, plus a few that are common enough in
+// the wild to be considered well-known.
+var knownItemTypes = [256]bool{
+	gopher.Text: true, gopher.Dir: true, gopher.CSOServer: true, gopher.ItemError: true,
+	gopher.BinHex: true, gopher.BinaryArchive: true, gopher.UUEncoded: true,
+	gopher.Search: true, gopher.Telnet: true, gopher.Binary: true, gopher.Duplicate: true,
+	gopher.GIF: true, gopher.Image: true, gopher.TN3270: true, gopher.SSH: true,
+	gopher.Calendar: true, gopher.Doc: true, gopher.HTML: true, gopher.Info: true,
+	gopher.Page: true, gopher.MBOX: true, gopher.Sound: true, gopher.XML: true,
+	gopher.Video: true,
+
+	':': true, // Gopher+ bitmap
+	'<': true, // Gopher+ sound
+	'P': true, // PDF
+	'r': true, // RTF
+}
+
+// Lint a raw menu, as it came off the wire, and return every problem found, in line
+// order.
+func Lint(data []byte, flags Flags) (problems []Problem) {
+	gophermap := flags&Gophermap != 0
+
+	add := func(line int, raw string, code string, msg string, args ...interface{}) {
+		problems = append(problems, Problem{Line: line, Code: code, Msg: fmt.Sprintf(msg, args...), Raw: raw})
+	}
+
+	lines := bytes.SplitAfter(data, []byte{'\n'})
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	terminated := false
+	lnum := 0
+	for _, bline := range lines {
+		lnum++
+		raw := string(bline)
+		line := strings.TrimSuffix(raw, "\n")
+
+		if !gophermap {
+			if !strings.HasSuffix(raw, "\n") {
+				add(lnum, raw, CodeCRLF, "line is not terminated")
+			} else if !strings.HasSuffix(line, "\r") {
+				add(lnum, raw, CodeCRLF, "line ends with LF instead of CRLF")
+			}
+		}
+		line = strings.TrimSuffix(line, "\r")
+
+		if terminated {
+			add(lnum, raw, CodeTerminator, "data after '.' terminator")
+			continue
+		}
+		if line == "." {
+			terminated = true
+			continue
+		}
+
+		problems = append(problems, lintLine(lnum, raw, line, gophermap)...)
+	}
+
+	if !terminated && !gophermap {
+		add(lnum+1, "", CodeTerminator, "missing '.' terminator")
+	}
+	return problems
+}
+
+func lintLine(lnum int, raw, line string, gophermap bool) (problems []Problem) {
+	add := func(code string, msg string, args ...interface{}) {
+		problems = append(problems, Problem{Line: lnum, Code: code, Msg: fmt.Sprintf(msg, args...), Raw: raw})
+	}
+
+	if gophermap && !strings.Contains(line, "\t") {
+		// The whole line is the display string of an info line, so the first character
+		// isn't an item type:
+		if c, ok := controlChar(line); ok {
+			add(CodeControl, "info line contains control character %q", c)
+		}
+		return problems
+	}
+
+	if line == "" {
+		add(CodeFields, "empty line")
+		return problems
+	}
+
+	it := gopher.ItemType(line[0])
+	if !knownItemTypes[it] {
+		add(CodeItemType, "unknown item type %s", it)
+	}
+
+	fields := strings.Split(line[1:], "\t")
+	if c, ok := controlChar(fields[0]); ok {
+		add(CodeControl, "display string contains control character %q", c)
+	}
+
+	// Gopher+ adds a fifth field containing '+' (or '?' for ASK forms):
+	nfields := len(fields)
+	if nfields == 5 && (fields[4] == "+" || fields[4] == "?") {
+		nfields = 4
+	}
+	if nfields > 4 || (nfields < 4 && !gophermap) {
+		add(CodeFields, "expected 4 tab-separated fields, found %d", len(fields))
+	}
+	if len(fields) < 4 {
+		return problems
+	}
+
+	host, port := strings.TrimSpace(fields[2]), strings.TrimSpace(fields[3])
+	if port == "" {
+		add(CodePort, "missing port")
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		add(CodePort, "invalid port %q", port)
+	}
+
+	// Per doc/gopher2-notes.txt, dirents that don't point anywhere should use an RFC
+	// 2606 '.invalid' host so clients can tell they aren't real:
+	if it == gopher.Info || it == gopher.ItemError {
+		if host != "invalid" && !strings.HasSuffix(host, ".invalid") &&
+			(host == "" || gopher.IsWellKnownDummyHostname(host)) {
+			add(CodeDummyHost, "dummy host %q should use the '.invalid' TLD", host)
+		}
+	}
+
+	return problems
+}
+
+func controlChar(s string) (rune, bool) {
+	for _, c := range s {
+		if c < 0x20 || c == 0x7f {
+			return c, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,45 @@
+package menulint
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	for idx, tc := range []struct {
+		in    string
+		flags Flags
+		codes string
+	}{
+		{"1Foo\t/foo\thost\t70\r\n.\r\n", 0, ""},
+		{"1Foo\t/foo\thost\t70\t+\r\n.\r\n", 0, ""},
+		{"iInfo\t\terror.invalid\t0\r\n.\r\n", 0, ""},
+		{"1Foo\t/foo\thost\t70\n.\n", 0, "crlf crlf"},
+		{"1Foo\t/foo\thost\t70\r\n", 0, "terminator"},
+		{"1Foo\t/foo\thost\t70\r\n.\r\nx", 0, "crlf terminator"},
+		{"1Foo\t/foo\thost\r\n.\r\n", 0, "fields"},
+		{"\r\n.\r\n", 0, "fields"},
+		{"1Foo\t/foo\thost\t\r\n.\r\n", 0, "port"},
+		{"1Foo\t/foo\thost\tx\r\n.\r\n", 0, "port"},
+		{"ZFoo\t/foo\thost\t70\r\n.\r\n", 0, "itemtype"},
+		{"iInfo\t\tfake\t0\r\n.\r\n", 0, "dummyhost"},
+		{"3Error\t\t\t0\r\n.\r\n", 0, "dummyhost"},
+		{"iInfo\x1b[1m\t\tx.invalid\t0\r\n.\r\n", 0, "control"},
+		{"1Foo\t/foo\thost\t70\n", Gophermap, ""},
+		{"Just some text\n\nZzz\n", Gophermap, ""},
+		{"Text \x1b[1mbold\n", Gophermap, "control"},
+		{"1Foo\tfoo\n1Bar\t/bar\thost\n", Gophermap, ""},
+		{"1Foo\t/foo\thost\t70\tx\n", Gophermap, "fields"},
+		{"iJust some text\r\n.\r\n", 0, "fields"},
+	} {
+		t.Run("", func(t *testing.T) {
+			var codes []string
+			for _, p := range Lint([]byte(tc.in), tc.flags) {
+				codes = append(codes, p.Code)
+			}
+			if result := strings.Join(codes, " "); result != tc.codes {
+				t.Fatalf("%d: %q != %q", idx, result, tc.codes)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+// Package mirror stores a gopherhole in a directory that a Bucktooth-style server can
+// serve, with each menu saved as a 'gophermap' file in the directory for its selector.
+// See doc/gophermap.txt for the format.
+package mirror
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/shabbyrobe/fur/internal/crawl"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// Gophermap is the name of the file each menu is stored in.
+const Gophermap = "gophermap"
+
+// Mirror of everything on Root's server whose selector is Root's selector, or is below
+// it if selectors are treated as slash-separated paths.
+//
+// Documents are written as they are fetched, but menus are held until WriteMenus, so
+// that their links can be rewritten to point at everything that made it into the
+// mirror.
+type Mirror struct {
+	Root gopher.URL
+	Dir  string
+
+	root  string
+	menus map[string]menu
+}
+
+type menu struct {
+	url  gopher.URL
+	data []byte
+}
+
+func New(root gopher.URL, dir string) (*Mirror, error) {
+	sel, ok := clean(root.Selector)
+	if !ok {
+		return nil, fmt.Errorf("mirror: can't mirror selector %q", root.Selector)
+	}
+	return &Mirror{
+		Root:  root,
+		Dir:   dir,
+		root:  sel,
+		menus: map[string]menu{},
+	}, nil
+}
+
+// Selector returns the selector u has when the mirror is served from the root of a
+// server, or false if u isn't part of the mirror.
+func (m *Mirror) Selector(u gopher.URL) (sel string, ok bool) {
+	if !strings.EqualFold(u.Hostname, m.Root.Hostname) || port(u) != port(m.Root) {
+		return "", false
+	}
+	sel, ok = clean(u.Selector)
+	if !ok {
+		return "", false
+	}
+	if m.root != "" {
+		if sel == m.root {
+			sel = ""
+		} else if strings.HasPrefix(sel, m.root+"/") {
+			sel = sel[len(m.root)+1:]
+		} else {
+			return "", false
+		}
+	}
+	if sel == "" && !crawl.IsMenu(u) {
+		// Only a menu can be stored at the root of the mirror:
+		return "", false
+	}
+	return "/" + sel, true
+}
+
+// Path returns the file u is stored in, or false if u isn't part of the mirror.
+func (m *Mirror) Path(u gopher.URL) (string, bool) {
+	sel, ok := m.Selector(u)
+	if !ok {
+		return "", false
+	}
+	path := filepath.Join(m.Dir, filepath.FromSlash(sel))
+	if crawl.IsMenu(u) {
+		path = filepath.Join(path, Gophermap)
+	}
+	return path, true
+}
+
+// Exists reports whether u is in the mirror, either because it's waiting for
+// WriteMenus or because it has been stored by this or an earlier run.
+func (m *Mirror) Exists(u gopher.URL) bool {
+	path, ok := m.Path(u)
+	if !ok {
+		return false
+	}
+	if _, ok := m.menus[path]; ok {
+		return true
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// AddMenu holds the menu fetched from u until WriteMenus.
+func (m *Mirror) AddMenu(u gopher.URL, data []byte) error {
+	path, ok := m.Path(u)
+	if !ok || !crawl.IsMenu(u) {
+		return fmt.Errorf("mirror: %s is not a menu in the mirror", u)
+	}
+	m.menus[path] = menu{url: u, data: data}
+	return nil
+}
+
+// WriteDocument stores the response to u. Text responses are stored with '\n' line
+// endings and without their terminating '.' line, as the server serving the mirror adds
+// its own.
+func (m *Mirror) WriteDocument(u gopher.URL, data []byte) error {
+	path, ok := m.Path(u)
+	if !ok || crawl.IsMenu(u) {
+		return fmt.Errorf("mirror: %s is not a document in the mirror", u)
+	}
+	if !u.ItemType.IsBinary() && u.ItemType != gopher.UUEncoded {
+		text, err := ioutil.ReadAll(gopher.NewTextReader(bytes.NewReader(data)))
+		if err != nil {
+			return fmt.Errorf("mirror: %s: %w", u, err)
+		}
+		data = text
+	}
+	return writeFile(path, data)
+}
+
+// WriteMenus stores every menu added with AddMenu as a gophermap, and returns the URLs
+// of the ones that are new or have changed since the last time they were stored.
+//
+// A menu that can't be stored, such as one whose directory clashes with a document of
+// the same name, doesn't stop the others from being stored; the first error is
+// returned once they have been.
+func (m *Mirror) WriteMenus() (changed []gopher.URL, err error) {
+	paths := make([]string, 0, len(m.menus))
+	for path := range m.menus {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var failed int
+	for _, path := range paths {
+		mn := m.menus[path]
+		data, merr := m.Gophermap(mn.url, mn.data)
+		if merr == nil {
+			if cur, rerr := ioutil.ReadFile(path); rerr == nil && bytes.Equal(cur, data) {
+				continue
+			}
+			merr = writeFile(path, data)
+		}
+		if merr != nil {
+			if err == nil {
+				err = merr
+			}
+			failed++
+			continue
+		}
+		changed = append(changed, mn.url)
+	}
+	m.menus = map[string]menu{}
+	if failed > 1 {
+		err = fmt.Errorf("mirror: %d menus not written, the first because: %w", failed, err)
+	}
+	return changed, err
+}
+
+// Gophermap rewrites the menu fetched from u as a gophermap. Links to anything in the
+// mirror are replaced with the selector it has in the mirror, and the host and port are
+// left out so the server fills in its own. Bucktooth would also fill in its own host and
+// port for every other link that doesn't have one, so they are filled in with u's.
+func (m *Mirror) Gophermap(u gopher.URL, data []byte) ([]byte, error) {
+	rdr := gopher.NewDirReader(bytes.NewReader(data))
+	rdr.Flag = gopher.DirentHostOptional
+
+	var out bytes.Buffer
+	var dirent gopher.Dirent
+	for rdr.Read(&dirent) {
+		if dirent.ItemType == gopher.Info || dirent.ItemType == gopher.ItemError {
+			out.WriteString(dirent.Raw)
+			out.WriteByte('\n')
+			continue
+		}
+		if _, ok := dirent.WWW(); ok {
+			out.WriteString(dirent.Raw)
+			out.WriteByte('\n')
+			continue
+		}
+
+		if dirent.Hostname == "" {
+			dirent.Hostname, dirent.Port = u.Hostname, u.Port
+		}
+		if dirent.Port == "" {
+			dirent.Port = "70"
+		}
+		link := dirent.URL()
+		if sel, ok := m.Selector(link); ok && m.Exists(link) {
+			fmt.Fprintf(&out, "%c%s\t%s\n", dirent.ItemType, dirent.Display, sel)
+			continue
+		}
+
+		fmt.Fprintf(&out, "%c%s\t%s\t%s\t%s", dirent.ItemType, dirent.Display, dirent.Selector, dirent.Hostname, dirent.Port)
+		if dirent.Plus {
+			out.WriteString("\t+")
+		}
+		out.WriteByte('\n')
+	}
+	if err := rdr.ReadErr(); err != nil {
+		return nil, fmt.Errorf("mirror: invalid menu %s: %w", u, err)
+	}
+	return out.Bytes(), nil
+}
+
+func port(u gopher.URL) string {
+	if u.Port == "" {
+		return "70"
+	}
+	return u.Port
+}
+
+// clean turns a selector into a slash-separated path, without leading or trailing
+// slashes. Selectors that can't be stored without clashing with another selector, or
+// without escaping the mirror, are rejected.
+func clean(sel string) (string, bool) {
+	sel = strings.Trim(sel, "/")
+	if sel == "" {
+		return "", true
+	}
+	for _, part := range strings.Split(sel, "/") {
+		if part == "" || part == "." || part == ".." || part == Gophermap {
+			return "", false
+		}
+		if strings.ContainsAny(part, "\x00\\") {
+			return "", false
+		}
+	}
+	return sel, true
+}
+
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return fmt.Errorf("mirror: write %q failed: %w", path, err)
+	}
+
+	var b [16]byte
+	rand.Read(b[:])
+	tmpPath := path + "." + hex.EncodeToString(b[:])
+	if err := ioutil.WriteFile(tmpPath, data, 0666); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("mirror: write %q failed: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("mirror: write %q failed: %w", path, err)
+	}
+	return nil
+}
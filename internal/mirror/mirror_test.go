@@ -0,0 +1,159 @@
+package mirror
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+func TestSelector(t *testing.T) {
+	root := gopher.URL{Scheme: "gopher", Hostname: "host", ItemType: gopher.Dir, Selector: "/path/"}
+	m, err := New(root, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, tc := range []struct {
+		url string
+		sel string
+		ok  bool
+	}{
+		{"gopher://host/1/path", "/", true},
+		{"gopher://HOST:70/1/path/", "/", true},
+		{"gopher://host/0/path/a.txt", "/a.txt", true},
+		{"gopher://host/1/path/a/b/", "/a/b", true},
+		{"gopher://host/9/path/a/b.zip", "/a/b.zip", true},
+		{"gopher://host/0/path", "", false},
+		{"gopher://host/1/pathological", "", false},
+		{"gopher://host/1/", "", false},
+		{"gopher://host:7070/1/path/a", "", false},
+		{"gopher://other/1/path/a", "", false},
+		{"gopher://host/1/path/../etc", "", false},
+		{"gopher://host/1/path//a", "", false},
+		{"gopher://host/0/path/gophermap", "", false},
+	} {
+		u, err := gopher.ParseURL(tc.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sel, ok := m.Selector(u)
+		if sel != tc.sel || ok != tc.ok {
+			t.Fatalf("%d: %s: %q %v != %q %v", idx, tc.url, sel, ok, tc.sel, tc.ok)
+		}
+	}
+}
+
+func TestGophermap(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	root := gopher.URL{Scheme: "gopher", Hostname: "host", ItemType: gopher.Dir, Selector: "/path"}
+	m, err := New(root, tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := gopher.URL{Scheme: "gopher", Hostname: "host", Port: "70", ItemType: gopher.Dir, Selector: "/path/sub"}
+	if err := m.AddMenu(u, []byte("1Up\t/path\thost\t70\r\n.\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteDocument(gopher.URL{Scheme: "gopher", Hostname: "host", ItemType: gopher.Text, Selector: "/path/a.txt"}, []byte("..dot\r\n.\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	menu := "" +
+		"iHello\t\terror.invalid\t0\r\n" +
+		"0Mirrored\t/path/a.txt\thost\t70\r\n" +
+		"1Pending menu\t/path/sub\thost\t70\r\n" +
+		"0Not fetched\t/path/b.txt\thost\t70\r\n" +
+		"0No host\t/path/c.txt\r\n" +
+		"1Outside\t/other\thost\t70\t+\r\n" +
+		"1Elsewhere\t/path/a.txt\tother\t70\r\n" +
+		"hWeb\tURL:http://example.com\r\n" +
+		".\r\n"
+
+	expected := "" +
+		"iHello\t\terror.invalid\t0\n" +
+		"0Mirrored\t/a.txt\n" +
+		"1Pending menu\t/sub\n" +
+		"0Not fetched\t/path/b.txt\thost\t70\n" +
+		"0No host\t/path/c.txt\thost\t70\n" +
+		"1Outside\t/other\thost\t70\t+\n" +
+		"1Elsewhere\t/path/a.txt\tother\t70\n" +
+		"hWeb\tURL:http://example.com\n"
+
+	result, err := m.Gophermap(root, []byte(menu))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != expected {
+		t.Fatalf("%q\n!=\n%q", result, expected)
+	}
+
+	text, err := ioutil.ReadFile(filepath.Join(tmp, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != ".dot\n" {
+		t.Fatalf("%q", text)
+	}
+
+	changed, err := m.WriteMenus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 1 {
+		t.Fatal(changed)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "sub", Gophermap)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestWriteMenusClash stores a document where a menu's directory should go, which
+// should only stop that menu from being stored.
+func TestWriteMenusClash(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	root := gopher.URL{Scheme: "gopher", Hostname: "host", ItemType: gopher.Dir, Selector: "/"}
+	m, err := New(root, tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.WriteDocument(gopher.URL{Hostname: "host", ItemType: gopher.Text, Selector: "/foo"}, []byte("foo\r\n.\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, sel := range []string{"/foo/bar", "/baz", "/qux"} {
+		if err := m.AddMenu(gopher.URL{Hostname: "host", ItemType: gopher.Dir, Selector: sel}, []byte(".\r\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changed, err := m.WriteMenus()
+	if err == nil {
+		t.Fatal("expected error")
+	} else if len(changed) != 2 {
+		t.Fatal(changed)
+	}
+	for _, dir := range []string{"baz", "qux"} {
+		if _, err := os.Stat(filepath.Join(tmp, dir, Gophermap)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nor can a document be stored where a menu's directory is:
+	if err := m.WriteDocument(gopher.URL{Hostname: "host", ItemType: gopher.Text, Selector: "/baz"}, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
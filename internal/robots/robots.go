@@ -0,0 +1,232 @@
+// Package robots parses robots.txt files, which gopher servers serve as the text
+// selector 'robots.txt' to tell crawlers what to stay out of. This is the same file and
+// format crawlers like Veronica-2 use:
+//
+//	User-agent: *
+//	Disallow: /cgi-bin
+//	Allow: /cgi-bin/hello
+//	Crawl-delay: 5
+package robots
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Selector that servers are expected to serve the robots file from.
+const Selector = "robots.txt"
+
+// Agent is the name fur looks for in User-agent lines.
+const Agent = "fur"
+
+// MaxSize is the largest robots file Parse will read; anything after it is ignored.
+const MaxSize = 1 << 17
+
+// Rule allows or disallows selectors starting with Path. Path may contain '*', which
+// matches any run of characters, and may end in '$', which anchors it to the end of the
+// selector.
+type Rule struct {
+	Allow bool
+	Path  string
+}
+
+type group struct {
+	agents []string
+	rules  []Rule
+	delay  time.Duration
+}
+
+// File is a parsed robots.txt, made up of groups of rules, each for one or more user
+// agents.
+//
+// A nil *File is a server without a robots file, which allows everything.
+type File struct {
+	groups []*group
+}
+
+// Parse a robots file. Robots files are written by hand and rarely checked, so anything
+// that can't be understood is ignored rather than rejected; the only errors are from
+// reading rdr.
+func Parse(rdr io.Reader) (*File, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(rdr, MaxSize))
+	if err != nil {
+		return nil, fmt.Errorf("robots: read failed: %w", err)
+	}
+	return ParseBytes(data), nil
+}
+
+func ParseBytes(data []byte) *File {
+	f := &File{}
+
+	var cur *group
+	var inAgents bool
+
+	scn := bufio.NewScanner(bytes.NewReader(data))
+	scn.Buffer(make([]byte, 0, 4096), MaxSize)
+	for scn.Scan() {
+		line := scn.Text()
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+
+		// Some servers append a '.' line to the file as if it were sent as text:
+		if line == "." {
+			break
+		}
+
+		idx := strings.IndexByte(line, ':')
+		if idx < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:idx]))
+		value := strings.TrimSpace(line[idx+1:])
+
+		switch key {
+		case "user-agent":
+			// Consecutive User-agent lines share the rules that follow them:
+			if !inAgents {
+				cur = &group{}
+				f.groups = append(f.groups, cur)
+				inAgents = true
+			}
+			cur.agents = append(cur.agents, strings.ToLower(value))
+
+		case "allow", "disallow":
+			inAgents = false
+			if cur == nil {
+				continue // Rules must follow a User-agent line
+			}
+			if value == "" {
+				// An empty Disallow allows everything, which is already the default:
+				continue
+			}
+			cur.rules = append(cur.rules, Rule{Allow: key == "allow", Path: normalize(value)})
+
+		case "crawl-delay":
+			inAgents = false
+			if cur == nil {
+				continue
+			}
+			secs, err := strconv.ParseFloat(value, 64)
+			if err == nil && secs > 0 {
+				cur.delay = time.Duration(secs * float64(time.Second))
+			}
+
+		default:
+			// Sitemap and friends aren't tied to a group and aren't of any use to us,
+			// but they don't end the group either.
+		}
+	}
+
+	// Errors can only come from lines longer than MaxSize, which can't be a rule we
+	// could use anyway; anything before them has been kept.
+	return f
+}
+
+// Rules returns the rules that apply to agent: those from every group naming agent, or
+// if there are none, those from every group for '*'. Agents are matched
+// case-insensitively.
+func (f *File) Rules(agent string) *Rules {
+	rules := &Rules{}
+	if f == nil {
+		return rules
+	}
+
+	agent = strings.ToLower(agent)
+	for _, want := range []string{agent, "*"} {
+		for _, g := range f.groups {
+			for _, ga := range g.agents {
+				if ga == want {
+					rules.rules = append(rules.rules, g.rules...)
+					if g.delay > rules.Delay {
+						rules.Delay = g.delay
+					}
+					break
+				}
+			}
+		}
+		if len(rules.rules) > 0 || rules.Delay > 0 {
+			break
+		}
+	}
+	return rules
+}
+
+// Rules for a single user agent.
+type Rules struct {
+	rules []Rule
+
+	// Minimum time between requests asked for with Crawl-delay, or 0 if there isn't one.
+	Delay time.Duration
+}
+
+// Allowed reports whether selector may be fetched. The rule with the longest Path that
+// matches the selector wins; if an Allow and a Disallow rule are just as long, the Allow
+// rule wins. Selectors that no rule matches are allowed.
+//
+// Gopher selectors don't have to start with a '/', but robots files are nearly always
+// written as if they do, so a '/' is added to the start of selectors and paths that
+// don't have one before they are compared.
+func (r *Rules) Allowed(selector string) bool {
+	if r == nil {
+		return true
+	}
+	selector = normalize(selector)
+
+	allowed, best := true, -1
+	for _, rule := range r.rules {
+		if len(rule.Path) < best || !match(rule.Path, selector) {
+			continue
+		}
+		if len(rule.Path) > best || rule.Allow {
+			allowed, best = rule.Allow, len(rule.Path)
+		}
+	}
+	return allowed
+}
+
+func normalize(path string) string {
+	if !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "*") {
+		return "/" + path
+	}
+	return path
+}
+
+// match reports whether pattern matches the start of s, or all of it if pattern ends
+// with '$'.
+func match(pattern, s string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || s == ""
+	}
+
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(s, part)
+		if idx < 0 {
+			return false
+		}
+		s = s[idx+len(part):]
+	}
+
+	last := parts[len(parts)-1]
+	if anchored {
+		return strings.HasSuffix(s, last)
+	}
+	return strings.Contains(s, last)
+}
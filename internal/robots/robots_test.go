@@ -0,0 +1,61 @@
+package robots
+
+import (
+	"testing"
+	"time"
+)
+
+const testRobots = `# Comments are ignored
+User-agent: veronica
+User-agent: fur
+Disallow: /private
+Allow: /private/ok   # except this
+Disallow: /*.cgi$
+Disallow: /tmp/*/cache
+Crawl-delay: 2.5
+
+User-agent: *
+Disallow: /
+.
+User-agent: fur
+Disallow: /after-the-dot
+`
+
+func TestAllowed(t *testing.T) {
+	f := ParseBytes([]byte(testRobots))
+	for idx, tc := range []struct {
+		agent    string
+		selector string
+		allowed  bool
+	}{
+		{"fur", "/", true},
+		{"FUR", "/private", false},
+		{"fur", "private/stuff", false},
+		{"fur", "/private/ok", true},
+		{"fur", "/private/ok/deeper", true},
+		{"fur", "/script.cgi", false},
+		{"fur", "/script.cgi?x", true},
+		{"fur", "/tmp/a/b/cache/x", false},
+		{"fur", "/tmp/cache", true},
+		{"fur", "/after-the-dot", true},
+		{"veronica", "/private", false},
+		{"other", "/", false},
+		{"other", "/anything", false},
+	} {
+		if result := f.Rules(tc.agent).Allowed(tc.selector); result != tc.allowed {
+			t.Fatalf("%d: %s %q: %v != %v", idx, tc.agent, tc.selector, result, tc.allowed)
+		}
+	}
+
+	if d := f.Rules("fur").Delay; d != 2500*time.Millisecond {
+		t.Fatal(d)
+	}
+	if d := f.Rules("other").Delay; d != 0 {
+		t.Fatal(d)
+	}
+
+	var none *File
+	if !none.Rules("fur").Allowed("/private") {
+		t.Fatal()
+	}
+}
@@ -0,0 +1,130 @@
+package robots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// URL returns the URL of the robots file for the server at host and port.
+func URL(host, port string) gopher.URL {
+	if port == "" {
+		port = "70"
+	}
+	return gopher.URL{
+		Scheme:   "gopher",
+		Hostname: host,
+		Port:     port,
+		ItemType: gopher.Text,
+		Selector: Selector,
+	}
+}
+
+// Fetch and parse the robots file for the server at host and port. If the server reports
+// an error, such as the file not existing, Fetch returns nil, nil, which allows
+// everything.
+func Fetch(ctx context.Context, client *gopher.Client, host, port string) (*File, error) {
+	rq := gopher.NewRequest(URL(host, port), nil)
+	rs, err := client.Text(ctx, rq)
+	if err != nil {
+		var gopherErr *gopher.Error
+		if errors.As(err, &gopherErr) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("robots: fetch from %s failed: %w", net.JoinHostPort(host, port), err)
+	}
+	defer rs.Close()
+
+	f, err := Parse(rs.Reader())
+	if err != nil {
+		return nil, fmt.Errorf("robots: fetch from %s failed: %w", net.JoinHostPort(host, port), err)
+	}
+	return f, nil
+}
+
+// Source fetches robots files using Client and keeps the rules for Agent in memory, so
+// each server's file is only fetched once.
+//
+// Network errors are returned as-is and are not kept, so the file is fetched again next
+// time it's needed.
+type Source struct {
+	// Client should be a copy of the client used for regular requests, without its
+	// Recorder, so robots files don't end up among the responses.
+	Client *gopher.Client
+
+	// ClientFor, if set, returns the client to fetch the robots file at u with, given
+	// Client. It can be used to configure the client per host, such as to check pinned
+	// certificates.
+	ClientFor func(client *gopher.Client, u gopher.URL) *gopher.Client
+
+	// Agent to find the rules for. Defaults to robots.Agent.
+	Agent string
+
+	mu     sync.Mutex
+	loaded map[string]*loadedRobots
+}
+
+type loadedRobots struct {
+	mu    sync.Mutex
+	rules *Rules
+}
+
+func NewSource(client *gopher.Client) *Source {
+	return &Source{
+		Client: client,
+		Agent:  Agent,
+		loaded: map[string]*loadedRobots{},
+	}
+}
+
+// Load the rules for the server at host and port. Servers are loaded independently, so
+// a slow server doesn't hold up requests for the others.
+func (src *Source) Load(ctx context.Context, host, port string) (*Rules, error) {
+	if port == "" {
+		port = "70"
+	}
+	key := strings.ToLower(host) + ":" + port
+
+	src.mu.Lock()
+	lr := src.loaded[key]
+	if lr == nil {
+		lr = &loadedRobots{}
+		src.loaded[key] = lr
+	}
+	src.mu.Unlock()
+
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if lr.rules != nil {
+		return lr.rules, nil
+	}
+
+	client := src.Client
+	if src.ClientFor != nil {
+		client = src.ClientFor(client, URL(host, port))
+	}
+	f, err := Fetch(ctx, client, host, port)
+	if err != nil {
+		return nil, err
+	}
+	agent := src.Agent
+	if agent == "" {
+		agent = Agent
+	}
+	lr.rules = f.Rules(agent)
+	return lr.rules, nil
+}
+
+// Allowed reports whether u may be fetched.
+func (src *Source) Allowed(ctx context.Context, u gopher.URL) (bool, error) {
+	rules, err := src.Load(ctx, u.Hostname, u.Port)
+	if err != nil {
+		return false, err
+	}
+	return rules.Allowed(u.Selector), nil
+}
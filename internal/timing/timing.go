@@ -0,0 +1,352 @@
+// Package timing breaks down how long gopher requests take into phases: looking up the
+// host, connecting, the TLS handshake, waiting for the first byte of the response, and
+// transferring the rest, so a server that is slow at handshakes can be told apart from
+// one that is slow at generating menus.
+//
+// Requests are timed by a Tracer installed in the gopher.Client, which wraps its
+// DialContext. Only requests made with a Trace in their context are timed:
+//
+//	tc := timing.Install(client)
+//	tr := &timing.Trace{}
+//	rs, err := client.Fetch(timing.WithTrace(ctx, tr), rq)
+//	tr.Received()
+//	...
+//	phases, ok := tr.Timing()
+//
+// The wrapped connection only sees encrypted bytes when TLS is used, and in TLS 1.3
+// the first of them may be a session ticket the server sent as soon as the handshake
+// finished, rather than the response. The first byte of the response can only be seen
+// once it's decrypted, so callers mark it with Received, or by reading the response
+// through Reader.
+package timing
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+type traceKey struct{}
+
+// WithTrace returns a context that times any request made with it using tr.
+func WithTrace(ctx context.Context, tr *Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, tr)
+}
+
+// FromContext returns the Trace in ctx, or nil if there isn't one.
+func FromContext(ctx context.Context) *Trace {
+	tr, _ := ctx.Value(traceKey{}).(*Trace)
+	return tr
+}
+
+// First byte of a TLS record, which is its content type. Encrypted handshake messages
+// are sent as application data in TLS 1.3, so the first application data record the
+// client sends is either its Finished message or the request, at which point the
+// client is done with the handshake either way.
+const (
+	tlsRecordHandshake       = 0x16
+	tlsRecordApplicationData = 0x17
+)
+
+// Trace collects the times of the events in a single request. The zero value is ready
+// to use. If the client makes more than one connection for the request, such as when
+// it falls back to plain gopher after failing to connect with TLS, only the last one
+// is timed.
+type Trace struct {
+	mu        sync.Mutex
+	dialStart time.Time
+	dnsDone   time.Time
+	connected time.Time
+	wrote     bool
+	tls       bool
+	tlsDone   time.Time
+	sent      time.Time
+	firstRead time.Time // First read from the connection after sending
+	firstByte time.Time // First byte of the response, once decrypted
+	lastByte  time.Time
+}
+
+// Timing returns how long each phase took so far. ok is false if no connection was
+// made, i.e. if the request failed before dialling or the response came from a cache.
+func (tr *Trace) Timing() (t furball.Timing, ok bool) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if tr.connected.IsZero() {
+		return t, false
+	}
+
+	connectStart := tr.dialStart
+	if !tr.dnsDone.IsZero() {
+		t.DNS = furball.Duration(tr.dnsDone.Sub(tr.dialStart))
+		connectStart = tr.dnsDone
+	}
+	t.Connect = furball.Duration(tr.connected.Sub(connectStart))
+	if tr.tls && !tr.tlsDone.IsZero() {
+		t.TLS = furball.Duration(tr.tlsDone.Sub(tr.connected))
+	}
+
+	// Reads from a plain connection are the response, but reads from a TLS connection
+	// may not be, so the decrypted first byte is used if there is one:
+	firstByte := tr.firstRead
+	if tr.tls && !tr.firstByte.IsZero() {
+		firstByte = tr.firstByte
+	}
+	if !tr.sent.IsZero() && !firstByte.IsZero() {
+		t.TTFB = furball.Duration(firstByte.Sub(tr.sent))
+		if tr.lastByte.After(firstByte) {
+			t.Transfer = furball.Duration(tr.lastByte.Sub(firstByte))
+		}
+	}
+	return t, true
+}
+
+// Received records that the first byte of the response has arrived. Call it when
+// gopher.Client.Fetch returns, which reads the start of the response looking for
+// errors. Responses from gopher.Client.Raw should be read through Reader instead.
+// Received does nothing if tr is nil.
+func (tr *Trace) Received() {
+	if tr == nil {
+		return
+	}
+	now := time.Now()
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.firstByte.IsZero() && !tr.sent.IsZero() {
+		tr.firstByte = now
+	}
+}
+
+// Reader returns a reader that calls Received when the first byte is read from rdr. If
+// tr is nil, rdr is returned as-is.
+func (tr *Trace) Reader(rdr io.Reader) io.Reader {
+	if tr == nil {
+		return rdr
+	}
+	return &receivedReader{rdr: rdr, tr: tr}
+}
+
+type receivedReader struct {
+	rdr  io.Reader
+	tr   *Trace
+	done bool
+}
+
+func (rr *receivedReader) Read(b []byte) (n int, err error) {
+	n, err = rr.rdr.Read(b)
+	if n > 0 && !rr.done {
+		rr.done = true
+		rr.tr.Received()
+	}
+	return n, err
+}
+
+func (tr *Trace) dialing() {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.dialStart = time.Now()
+	tr.dnsDone, tr.connected, tr.tlsDone = time.Time{}, time.Time{}, time.Time{}
+	tr.sent, tr.firstRead, tr.firstByte, tr.lastByte = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+	tr.wrote, tr.tls = false, false
+}
+
+func (tr *Trace) resolved() {
+	tr.mu.Lock()
+	tr.dnsDone = time.Now()
+	tr.mu.Unlock()
+}
+
+func (tr *Trace) dialled() {
+	tr.mu.Lock()
+	tr.connected = time.Now()
+	tr.mu.Unlock()
+}
+
+func (tr *Trace) writing(b []byte) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if len(b) == 0 {
+		return
+	}
+	if !tr.wrote {
+		tr.wrote = true
+		tr.tls = b[0] == tlsRecordHandshake
+	}
+	if tr.tls && tr.tlsDone.IsZero() && b[0] == tlsRecordApplicationData {
+		tr.tlsDone = time.Now()
+	}
+}
+
+// written is called after each write. The response can't start arriving until the
+// request has been sent, so the first read is the first one after the last write of
+// application data. Writes after the reads start, like TLS's close_notify alert, are
+// ignored.
+func (tr *Trace) written(b []byte) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if len(b) == 0 || !tr.firstRead.IsZero() {
+		return
+	}
+	if !tr.tls || b[0] == tlsRecordApplicationData {
+		tr.sent = time.Now()
+	}
+}
+
+func (tr *Trace) read() {
+	now := time.Now()
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.sent.IsZero() {
+		return // Still in the TLS handshake
+	}
+	if tr.firstRead.IsZero() {
+		tr.firstRead = now
+	}
+	tr.lastByte = now
+}
+
+type tracedConn struct {
+	net.Conn
+	tr *Trace
+}
+
+func (tc *tracedConn) Write(b []byte) (n int, err error) {
+	tc.tr.writing(b)
+	n, err = tc.Conn.Write(b)
+	tc.tr.written(b)
+	return n, err
+}
+
+func (tc *tracedConn) Read(b []byte) (n int, err error) {
+	n, err = tc.Conn.Read(b)
+	if n > 0 {
+		tc.tr.read()
+	}
+	return n, err
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Tracer times the requests made by a gopher.Client that have a Trace in their
+// context, and adds the timing to the furball entries recorded for them.
+type Tracer struct {
+	dial     dialFunc
+	timeout  time.Duration
+	recorder gopher.Recorder
+	traces   sync.Map // *gopher.Request: *Trace
+}
+
+var _ gopher.Recorder = &Tracer{}
+
+// Install a Tracer in client. Install after anything else that wraps or copies the
+// client's DialContext, like caps sources, so their requests aren't timed as part of
+// the requests that cause them.
+func Install(client *gopher.Client) *Tracer {
+	tc := &Tracer{
+		dial:     client.DialContext,
+		timeout:  client.Timeout,
+		recorder: client.Recorder,
+	}
+	if tc.timeout <= 0 {
+		tc.timeout = gopher.DefaultTimeout
+	}
+	client.DialContext = tc.dialContext
+	if client.Recorder != nil {
+		client.Recorder = tc
+	}
+	return tc
+}
+
+// Track adds the timing of rq to the furball entry recorded for it, if the client is
+// recording. rq must be sent with a context from WithTrace(ctx, tr).
+func (tc *Tracer) Track(rq *gopher.Request, tr *Trace) {
+	if tc.recorder != nil {
+		tc.traces.Store(rq, tr)
+	}
+}
+
+func (tc *Tracer) BeginRecording(rq *gopher.Request, at time.Time) gopher.Recording {
+	rec := tc.recorder.BeginRecording(rq, at)
+	if rec == nil {
+		return nil
+	}
+	v, ok := tc.traces.Load(rq)
+	if !ok {
+		return rec
+	}
+	return &tracedRecording{Recording: rec, tracer: tc, rq: rq, tr: v.(*Trace)}
+}
+
+type timingSetter interface {
+	SetTiming(t furball.Timing)
+}
+
+type tracedRecording struct {
+	gopher.Recording
+	tracer *Tracer
+	rq     *gopher.Request
+	tr     *Trace
+}
+
+func (tr *tracedRecording) Done(at time.Time) {
+	if ts, ok := tr.Recording.(timingSetter); ok {
+		if t, ok := tr.tr.Timing(); ok {
+			ts.SetTiming(t)
+		}
+	}
+	tr.tracer.traces.Delete(tr.rq)
+	tr.Recording.Done(at)
+}
+
+func (tc *Tracer) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	tr := FromContext(ctx)
+	if tr == nil {
+		return tc.dialUntraced(ctx, network, addr)
+	}
+
+	tr.dialing()
+	var conn net.Conn
+	var err error
+	if tc.dial != nil {
+		// Custom dialers, like Tor's, may do their own lookups, so the time they take is
+		// all counted as connecting:
+		conn, err = tc.dial(ctx, network, addr)
+	} else {
+		conn, err = tc.dialLookup(ctx, tr, network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tr.dialled()
+	return &tracedConn{Conn: conn, tr: tr}, nil
+}
+
+func (tc *Tracer) dialUntraced(ctx context.Context, network, addr string) (net.Conn, error) {
+	if tc.dial != nil {
+		return tc.dial(ctx, network, addr)
+	}
+	dialer := net.Dialer{Timeout: tc.timeout}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// dialLookup times the lookup of the host separately from connecting to it. The stock
+// dialer is used so that it still splits the timeout between addresses and races IPv4
+// against IPv6; it only creates a socket once the lookup is done, so the first one it
+// creates marks the end of the lookup.
+func (tc *Tracer) dialLookup(ctx context.Context, tr *Trace, network, addr string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: tc.timeout}
+	if host, _, err := net.SplitHostPort(addr); err == nil && net.ParseIP(host) == nil {
+		var once sync.Once
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			once.Do(tr.resolved)
+			return nil
+		}
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,170 @@
+package timing
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shabbyrobe/fur/internal/furball"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+const serveDelay = 20 * time.Millisecond
+
+// serveSlowly answers every request on ln with the same text after serveDelay.
+func serveSlowly(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+				return
+			}
+			time.Sleep(serveDelay)
+			conn.Write([]byte("hello\r\n.\r\n"))
+		}()
+	}
+}
+
+// testTLSConfig borrows the self-signed certificate httptest uses.
+func testTLSConfig() *tls.Config {
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	defer srv.Close()
+	return srv.TLS
+}
+
+func TestTrace(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		tls  bool
+	}{
+		{"plain", false},
+		{"tls", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var ln net.Listener
+			var err error
+			if tc.tls {
+				ln, err = tls.Listen("tcp", "127.0.0.1:0", testTLSConfig())
+			} else {
+				ln, err = net.Listen("tcp", "127.0.0.1:0")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			go serveSlowly(ln)
+
+			var ball furball.Ball
+			client := &gopher.Client{Recorder: &ball, TLSMode: gopher.TLSDisabled}
+			if tc.tls {
+				client.TLSMode = gopher.TLSInsist
+				client.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+			}
+			tracer := Install(client)
+
+			_, port, _ := net.SplitHostPort(ln.Addr().String())
+			u := gopher.URL{Hostname: "localhost", Port: port, ItemType: gopher.Text, Selector: "/"}
+			rq := gopher.NewRequest(u, nil)
+			tr := &Trace{}
+			tracer.Track(rq, tr)
+
+			rs, err := client.Fetch(WithTrace(context.Background(), tr), rq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr.Received()
+			if _, err := ioutil.ReadAll(rs.(*gopher.TextResponse)); err != nil {
+				t.Fatal(err)
+			}
+			if err := rs.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			phases, ok := tr.Timing()
+			if !ok {
+				t.Fatal("not timed")
+			}
+			if phases.DNS <= 0 || phases.Connect <= 0 {
+				t.Fatalf("lookup and connect not timed: %+v", phases)
+			}
+			if (phases.TLS > 0) != tc.tls {
+				t.Fatalf("unexpected TLS phase: %+v", phases)
+			}
+			if time.Duration(phases.TTFB) < serveDelay {
+				t.Fatalf("ttfb %s < %s", phases.TTFB, serveDelay)
+			}
+
+			if len(ball.Entries) != 1 || ball.Entries[0].Timing == nil || *ball.Entries[0].Timing != phases {
+				t.Fatalf("timing not recorded: %+v", ball.Entries)
+			}
+		})
+	}
+}
+
+// TestTraceSessionTicket plays the part of a TLS 1.3 client talking to a server that
+// sends a session ticket as soon as the handshake is done, then takes its time to
+// respond. The ticket must not be mistaken for the first byte of the response.
+func TestTraceSessionTicket(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		buf := make([]byte, 64)
+		for i := 0; i < 3; i++ { // ClientHello, Finished, request
+			if _, err := server.Read(buf); err != nil {
+				return
+			}
+		}
+		server.Write([]byte{tlsRecordApplicationData, 't', 'i', 'c', 'k', 'e', 't'})
+		time.Sleep(serveDelay)
+		server.Write([]byte{tlsRecordApplicationData, 'h', 'e', 'l', 'l', 'o'})
+	}()
+
+	tr := &Trace{}
+	tr.dialing()
+	tr.dialled()
+	conn := &tracedConn{Conn: client, tr: tr}
+
+	buf := make([]byte, 64)
+	for _, rec := range [][]byte{
+		{tlsRecordHandshake, 'h', 'e', 'l', 'l', 'o'},
+		{tlsRecordApplicationData, 'f', 'i', 'n'},
+		{tlsRecordApplicationData, '/', '\r', '\n'},
+	} {
+		if _, err := conn.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ { // Ticket, response
+		if _, err := conn.Read(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tr.Received()
+
+	phases, ok := tr.Timing()
+	if !ok {
+		t.Fatal("not timed")
+	}
+	if time.Duration(phases.TTFB) < serveDelay {
+		t.Fatalf("ttfb %s < %s", phases.TTFB, serveDelay)
+	}
+}
+
+func TestTraceUntimed(t *testing.T) {
+	var tr Trace
+	if _, ok := tr.Timing(); ok {
+		t.Fatal("unused trace should not be timed")
+	}
+}
@@ -0,0 +1,511 @@
+// Package tofu pins the TLS certificates of gopher servers on first use, like SSH's
+// known_hosts. Gopher servers almost always use self-signed certificates, so checking
+// them against certificate authorities proves nothing, but a certificate that changes
+// between visits is worth knowing about.
+//
+// Pins are kept in a file with one line per host:port, holding the SHA-256 of the
+// certificate's public key and when it was first seen:
+//
+//	# host:port fingerprint first-seen
+//	gopher.example.com:70 sha256:6d1f...e2a0 2020-03-07T04:28:43Z
+//
+// The public key is pinned rather than the whole certificate, so a certificate that is
+// renewed with the same key still matches.
+package tofu
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shabbyrobe/fur/internal/flock"
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+// Policy decides what happens when a server's certificate doesn't match its pin.
+type Policy string
+
+const (
+	// Strict refuses to connect.
+	Strict Policy = "strict"
+
+	// Warn connects anyway, after warning loudly. The pin is not replaced.
+	Warn Policy = "warn"
+
+	// Off doesn't pin certificates at all.
+	Off Policy = "off"
+)
+
+// ParsePolicy parses the name of a Policy, as given on the command line.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case Strict, Warn, Off:
+		return p, nil
+	}
+	return "", fmt.Errorf("tofu: unknown policy %q; expected %q, %q or %q", s, Strict, Warn, Off)
+}
+
+// lockTimeout is how long to wait for another process to finish writing the file.
+const lockTimeout = 10 * time.Second
+
+// Pin is the fingerprint of the public key a host presented the first time it was
+// seen.
+type Pin struct {
+	Host        string // host:port
+	Fingerprint string
+	Added       time.Time
+}
+
+// MismatchError is returned when a host's certificate doesn't match its pin, which
+// either means the server has a new certificate, or that someone is impersonating it.
+type MismatchError struct {
+	Pin         Pin
+	Fingerprint string
+}
+
+func (err *MismatchError) Error() string {
+	return fmt.Sprintf(""+
+		"tofu: certificate for %s has changed since %s; pinned %s, got %s. "+
+		"Someone could be impersonating the server. If the change is expected, use "+
+		"'fur tofu forget %s'",
+		err.Pin.Host, err.Pin.Added.Format("2006-01-02"), err.Pin.Fingerprint, err.Fingerprint, err.Pin.Host)
+}
+
+// DowngradeError is returned when a host with a pinned certificate is connected to
+// without TLS, which a server that has been using TLS shouldn't need.
+type DowngradeError struct {
+	Pin Pin
+}
+
+func (err *DowngradeError) Error() string {
+	return fmt.Sprintf(""+
+		"tofu: %s has had a pinned certificate since %s, but isn't using TLS. "+
+		"Someone could be impersonating the server. If the change is expected, use "+
+		"'fur tofu forget %s'",
+		err.Pin.Host, err.Pin.Added.Format("2006-01-02"), err.Pin.Host)
+}
+
+// Fingerprint of the certificate's public key.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Store of pins, backed by a file that may be shared with other processes. New pins are
+// added to the file as soon as they are seen.
+type Store struct {
+	Path   string
+	Policy Policy
+
+	// Log, if set, is told about new pins, and warned about mismatches under the Warn
+	// policy.
+	Log io.Writer
+
+	mu     sync.Mutex
+	pins   map[string]Pin
+	warned map[string]bool
+}
+
+// Load the pins in the file at path. A missing file has no pins.
+func Load(path string, policy Policy) (*Store, error) {
+	s := &Store{Path: path, Policy: policy, warned: make(map[string]bool)}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) reload() error {
+	pins, err := readFile(s.Path)
+	if err != nil {
+		return err
+	}
+	s.pins = pins
+	return nil
+}
+
+func readFile(path string) (map[string]Pin, error) {
+	pins := make(map[string]Pin)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pins, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("tofu: load %q failed: %w", path, err)
+	}
+	defer f.Close()
+
+	scn := bufio.NewScanner(f)
+	line := 0
+	for scn.Scan() {
+		line++
+		text := strings.TrimSpace(scn.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("tofu: load %q failed: line %d: expected 'host:port fingerprint first-seen'", path, line)
+		}
+		added, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("tofu: load %q failed: line %d: %w", path, line, err)
+		}
+
+		// If two processes pinned the same host at once, the first one wins:
+		if _, ok := pins[fields[0]]; !ok {
+			pins[fields[0]] = Pin{Host: fields[0], Fingerprint: fields[1], Added: added}
+		}
+	}
+	if err := scn.Err(); err != nil {
+		return nil, fmt.Errorf("tofu: load %q failed: %w", path, err)
+	}
+	return pins, nil
+}
+
+// Pins returns every pin, sorted by host.
+func (s *Store) Pins() []Pin {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pins := make([]Pin, 0, len(s.pins))
+	for _, pin := range s.pins {
+		pins = append(pins, pin)
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i].Host < pins[j].Host })
+	return pins
+}
+
+// Forget the pins for host, so the next certificate it presents is trusted. host is
+// either a host:port, or a host, which forgets the pins for every port on the host.
+// Returns the pins that were forgotten.
+func (s *Store) Forget(host string) (forgotten []Pin, rerr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.locked(func() error {
+		if err := s.reload(); err != nil {
+			return err
+		}
+
+		for key, pin := range s.pins {
+			if key == host || hostname(key) == host {
+				forgotten = append(forgotten, pin)
+				delete(s.pins, key)
+			}
+		}
+		if len(forgotten) == 0 {
+			return nil
+		}
+		return s.writeFile()
+	})
+	sort.Slice(forgotten, func(i, j int) bool { return forgotten[i].Host < forgotten[j].Host })
+	return forgotten, err
+}
+
+func hostname(hostPort string) string {
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return hostPort
+	}
+	return host
+}
+
+// Client returns a copy of client that checks the certificate presented for u against
+// its pin. If the store is nil, or u won't be fetched using TLS, client is returned
+// as-is.
+//
+// A host with a pin must keep using TLS. The client usually falls back to plain text
+// if the server doesn't speak TLS, but under the Strict policy, it isn't allowed to
+// for pinned hosts. Under the Warn policy it is, after warning.
+func (s *Store) Client(client *gopher.Client, u gopher.URL) *gopher.Client {
+	if s == nil || s.Policy == Off || (client.TLSMode == gopher.TLSDisabled && !u.IsSecure()) {
+		return client
+	}
+	host := u.Host()
+	pinned := *client
+	pinned.TLSClientConfig = s.Config(client.TLSClientConfig, u)
+	if s.Policy == Strict && s.pinned(host) {
+		pinned.TLSMode = gopher.TLSInsist
+	}
+
+	// Hosts that are pinned after the copy is made can still fall back to plain text,
+	// so that is caught when the request is sent:
+	dial := client.DialContext
+	if dial == nil {
+		timeout := client.Timeout
+		if timeout <= 0 {
+			timeout = gopher.DefaultTimeout
+		}
+		dialer := net.Dialer{Timeout: timeout}
+		dial = dialer.DialContext
+	}
+	pinned.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &watchedConn{Conn: conn, store: s, host: host}, nil
+	}
+	return &pinned
+}
+
+func (s *Store) pinned(host string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.pins[host]
+	return ok
+}
+
+// plain is called when a connection to host is used without TLS.
+func (s *Store) plain(host string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pin, ok := s.pins[host]
+	if !ok {
+		return nil
+	}
+	err := &DowngradeError{Pin: pin}
+	if s.Policy == Warn {
+		if !s.warned[host] {
+			s.logf("WARNING: %v\n", err)
+			s.warned[host] = true
+		}
+		return nil
+	}
+	return err
+}
+
+// First byte of a TLS handshake record, which every TLS connection starts with.
+const tlsRecordHandshake = 0x16
+
+// watchedConn tells the store if the first thing written to it isn't the start of a
+// TLS handshake.
+type watchedConn struct {
+	net.Conn
+	store *Store
+	host  string
+	wrote bool
+}
+
+func (wc *watchedConn) Write(b []byte) (n int, err error) {
+	if !wc.wrote && len(b) > 0 {
+		wc.wrote = true
+		if b[0] != tlsRecordHandshake {
+			if err := wc.store.plain(wc.host); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return wc.Conn.Write(b)
+}
+
+// Config returns a copy of base, which may be nil, that checks the certificate
+// presented for u against its pin instead of against certificate authorities.
+//
+// A certificate that doesn't match its pin is still accepted if a certificate
+// authority vouches for it, and replaces the pin, so certificates that are renewed
+// automatically with new keys don't raise the alarm.
+func (s *Store) Config(base *tls.Config, u gopher.URL) *tls.Config {
+	var conf *tls.Config
+	if base == nil {
+		conf = &tls.Config{}
+	} else {
+		conf = base.Clone()
+	}
+
+	host := u.Host()
+	conf.InsecureSkipVerify = true
+	conf.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		return s.verify(host, u.Hostname, rawCerts, conf.RootCAs)
+	}
+	return conf
+}
+
+func (s *Store) verify(host, serverName string, rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("tofu: %s presented no certificate", host)
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("tofu: %s presented an invalid certificate: %w", host, err)
+		}
+		certs[i] = cert
+	}
+	fp := Fingerprint(certs[0])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pin, ok := s.pins[host]
+	if ok && pin.Fingerprint == fp {
+		return nil
+	}
+
+	if ok && !vouchedFor(certs, serverName, roots) {
+		err := &MismatchError{Pin: pin, Fingerprint: fp}
+		if s.Policy == Warn {
+			if !s.warned[host] {
+				s.logf("WARNING: %v\n", err)
+				s.warned[host] = true
+			}
+			return nil
+		}
+		return err
+	}
+
+	return s.locked(func() error {
+		// Another process may have pinned the host since the file was loaded:
+		if err := s.reload(); err != nil {
+			return err
+		}
+		if cur, ok := s.pins[host]; ok && cur != pin {
+			if cur.Fingerprint == fp {
+				return nil
+			}
+			return &MismatchError{Pin: cur, Fingerprint: fp}
+		}
+
+		if ok {
+			s.logf("tofu: replacing pin for %s with %s, which is signed by a trusted authority\n", host, fp)
+		} else {
+			s.logf("tofu: pinning %s to %s on first use\n", host, fp)
+		}
+		s.pins[host] = Pin{Host: host, Fingerprint: fp, Added: time.Now().UTC().Truncate(time.Second)}
+		if ok {
+			return s.writeFile()
+		}
+		return s.appendFile(s.pins[host])
+	})
+}
+
+// vouchedFor reports whether a certificate authority vouches for the certificate
+// chain, as if InsecureSkipVerify were false.
+func vouchedFor(certs []*x509.Certificate, serverName string, roots *x509.CertPool) bool {
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       serverName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(opts)
+	return err == nil
+}
+
+func (s *Store) logf(msg string, args ...interface{}) {
+	if s.Log != nil {
+		fmt.Fprintf(s.Log, msg, args...)
+	}
+}
+
+// locked calls fn while holding the lock on the file. s.mu must be held.
+func (s *Store) locked(fn func() error) (rerr error) {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return fmt.Errorf("tofu: save %q failed: %w", s.Path, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+	lock, err := flock.Acquire(ctx, s.Path)
+	if err != nil {
+		return fmt.Errorf("tofu: save %q failed: %w", s.Path, err)
+	}
+	defer func() {
+		if err := lock.Release(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+	return fn()
+}
+
+func formatPin(pin Pin) string {
+	return fmt.Sprintf("%s %s %s\n", pin.Host, pin.Fingerprint, pin.Added.UTC().Format(time.RFC3339))
+}
+
+const fileHeader = "# host:port fingerprint first-seen\n"
+
+func (s *Store) appendFile(pin Pin) error {
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("tofu: save %q failed: %w", s.Path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("tofu: save %q failed: %w", s.Path, err)
+	}
+	line := formatPin(pin)
+	if info.Size() == 0 {
+		line = fileHeader + line
+	}
+	if _, err := io.WriteString(f, line); err != nil {
+		return fmt.Errorf("tofu: save %q failed: %w", s.Path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("tofu: save %q failed: %w", s.Path, err)
+	}
+	return nil
+}
+
+// writeFile replaces the file with the pins in s.
+func (s *Store) writeFile() (rerr error) {
+	var b [16]byte
+	rand.Read(b[:])
+	tmpPath := s.Path + "." + hex.EncodeToString(b[:])
+
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("tofu: save %q failed: %w", s.Path, err)
+	}
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+		if rerr != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	hosts := make([]string, 0, len(s.pins))
+	for host := range s.pins {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	bw := bufio.NewWriter(f)
+	bw.WriteString(fileHeader)
+	for _, host := range hosts {
+		bw.WriteString(formatPin(s.pins[host]))
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("tofu: save %q failed: %w", s.Path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("tofu: save %q failed: %w", s.Path, err)
+	}
+	f = nil
+
+	if err := os.Rename(tmpPath, s.Path); err != nil {
+		return fmt.Errorf("tofu: save %q failed: %w", s.Path, err)
+	}
+	return nil
+}
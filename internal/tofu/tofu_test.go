@@ -0,0 +1,184 @@
+package tofu
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shabbyrobe/furlib/gopher"
+)
+
+func selfSigned(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "known_hosts")
+
+	first, second := selfSigned(t), selfSigned(t)
+
+	for idx, tc := range []struct {
+		policy   Policy
+		host     string
+		cert     []byte
+		mismatch bool
+	}{
+		{Strict, "localhost:70", first, false},    // Pinned on first use
+		{Strict, "localhost:70", first, false},    // Matches
+		{Strict, "localhost:70", second, true},    // Changed
+		{Warn, "localhost:70", second, false},     // Changed, but allowed
+		{Strict, "localhost:7070", second, false}, // Pins are per port
+	} {
+		s, err := Load(path, tc.policy)
+		if err != nil {
+			t.Fatal(idx, err)
+		}
+		err = s.verify(tc.host, "localhost", [][]byte{tc.cert}, nil)
+
+		var mismatch *MismatchError
+		if errors.As(err, &mismatch) != tc.mismatch {
+			t.Fatalf("%d: unexpected error %v", idx, err)
+		} else if !tc.mismatch && err != nil {
+			t.Fatal(idx, err)
+		}
+	}
+
+	s, err := Load(path, Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pins := s.Pins()
+	if len(pins) != 2 || pins[0].Host != "localhost:70" || pins[1].Host != "localhost:7070" || pins[0].Fingerprint == pins[1].Fingerprint {
+		t.Fatalf("%+v", pins)
+	}
+
+	// Forgetting a host without a port forgets every port:
+	forgotten, err := s.Forget("localhost")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(forgotten) != 2 {
+		t.Fatalf("%+v", forgotten)
+	}
+	if s, err = Load(path, Strict); err != nil {
+		t.Fatal(err)
+	} else if len(s.Pins()) != 0 {
+		t.Fatalf("%+v", s.Pins())
+	}
+	if err := s.verify("localhost:70", "localhost", [][]byte{second}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDowngrade serves plain text on a port with a pinned certificate, as someone
+// impersonating the server might.
+func TestDowngrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+					return
+				}
+				conn.Write([]byte("impostor\r\n.\r\n"))
+			}()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	u := gopher.URL{Hostname: "127.0.0.1", Port: port, ItemType: gopher.Text, Selector: "/"}
+	cert := selfSigned(t)
+
+	for idx, tc := range []struct {
+		policy    Policy
+		pinBefore bool // Pin before the client is copied
+		ok        bool
+	}{
+		{Strict, true, false},
+		{Strict, false, false},
+		{Warn, true, true},
+		{Warn, false, true},
+	} {
+		path := filepath.Join(dir, fmt.Sprintf("known_hosts%d", idx))
+		s, err := Load(path, tc.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var log bytes.Buffer
+		s.Log = &log
+
+		pin := func() {
+			if err := s.verify(u.Host(), u.Hostname, [][]byte{cert}, nil); err != nil {
+				t.Fatal(idx, err)
+			}
+		}
+		if tc.pinBefore {
+			pin()
+		}
+		client := s.Client(&gopher.Client{TLSMode: gopher.TLSWithInsecure}, u)
+		if !tc.pinBefore {
+			pin()
+		}
+
+		rs, err := client.Fetch(context.Background(), gopher.NewRequest(u, nil))
+		if (err == nil) != tc.ok {
+			t.Fatalf("%d: unexpected error %v", idx, err)
+		}
+		if err == nil {
+			rs.Close()
+			if !strings.Contains(log.String(), "WARNING") {
+				t.Fatalf("%d: no warning: %q", idx, log.String())
+			}
+		}
+	}
+}